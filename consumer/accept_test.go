@@ -0,0 +1,236 @@
+package consumer
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/apache/rocketmq-client-go/v2/consumer"
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+	"github.com/ketianlin/krocketmq/encryption"
+	"github.com/ketianlin/krocketmq/model"
+	"github.com/ketianlin/krocketmq/schema"
+	"github.com/ketianlin/krocketmq/signing"
+)
+
+// newTestKeys 创建包含ids的StaticKeyProvider，当前密钥为第一个
+func newTestKeys(t *testing.T, ids ...string) *encryption.StaticKeyProvider {
+	t.Helper()
+	keys := make(map[string][]byte, len(ids))
+	for i, id := range ids {
+		keys[id] = bytes.Repeat([]byte{byte(i + 1)}, 32)
+	}
+	p, err := encryption.NewStaticKeyProvider(ids[0], keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// setTestKeyEnv 将newTestKeys(t, ids...)中的密钥写入prefix开头的环境变量，当前密钥为最后一个
+func setTestKeyEnv(t *testing.T, prefix string, ids ...string) {
+	for i, id := range ids {
+		t.Setenv(prefix+id, base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{byte(i + 1)}, 32)))
+	}
+	t.Setenv(prefix+"CURRENT", ids[len(ids)-1])
+}
+
+// sealMessage 按生产者的顺序先加密再签名，keys或signKeys为nil时跳过对应步骤
+func sealMessage(t *testing.T, keys encryption.KeyProvider, signKeys signing.KeyProvider, body string) *primitive.MessageExt {
+	t.Helper()
+	msg := primitive.NewMessage("T", []byte(body))
+	if keys != nil {
+		if err := encryption.Encrypt(keys, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if signKeys != nil {
+		if err := signing.Sign(signKeys, msg, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ext := &primitive.MessageExt{MsgId: "m1"}
+	ext.Topic, ext.Body = msg.Topic, msg.Body
+	ext.WithProperties(msg.GetProperties())
+	return ext
+}
+
+// initTestClient 用conf初始化r，测试结束时关闭
+func initTestClient(t *testing.T, r *consumerClient, conf *model.Config) {
+	t.Helper()
+	r.InitConfig(conf, func(im *model.InitCallbackMessage) {
+		if im.InitError != nil {
+			t.Fatal(im.InitError)
+		}
+	})
+	t.Cleanup(r.Close)
+}
+
+// rejected 设置RejectHandler，返回收到的错误
+func rejected(r *consumerClient) *[]error {
+	errs := new([]error)
+	r.SetRejectHandler(func(msg *primitive.MessageExt, err error) {
+		*errs = append(*errs, err)
+	})
+	return errs
+}
+
+func TestSignedEncryptedMessageRetried(t *testing.T) {
+	for _, mode := range []string{ConsumeModeOrderly, ConsumeModeConcurrently} {
+		r := newTestClient(t, model.ConsumerConfig{ConsumeMode: mode})
+		keys, signKeys := newTestKeys(t, "k1"), newTestKeys(t, "s1")
+		r.SetKeyProvider(keys)
+		r.SetSignKeyProvider(signKeys)
+		errs := rejected(r)
+		var bodies []string
+		handler := func(ctx context.Context, msg *primitive.MessageExt) error {
+			bodies = append(bodies, string(msg.Body))
+			if len(bodies) == 1 {
+				return errHandler
+			}
+			return nil
+		}
+		// rocketmq-client-go重试时再次投递同一个对象
+		msg := sealMessage(t, keys, signKeys, "secret")
+		cipherBody := string(msg.Body)
+		if res, _ := consumeOnce(r, handler, msg); res == consumer.ConsumeSuccess {
+			t.Fatalf("%s: 第一次处理失败不应确认", mode)
+		}
+		if res, _ := consumeOnce(r, handler, msg); res != consumer.ConsumeSuccess {
+			t.Fatalf("%s: 重试成功期望ConsumeSuccess, 实际%v", mode, res)
+		}
+		if len(*errs) != 0 || len(bodies) != 2 || bodies[0] != "secret" || bodies[1] != "secret" {
+			t.Fatalf("%s: 重试时应当再次校验并解密, 拒绝:%v, 处理:%v", mode, *errs, bodies)
+		}
+		if string(msg.Body) != cipherBody || !encryption.IsEncrypted(&msg.Message) {
+			t.Fatalf("%s: 原消息不应被解密", mode)
+		}
+	}
+}
+
+func TestRejectHandler(t *testing.T) {
+	keys, signKeys := newTestKeys(t, "k1"), newTestKeys(t, "s1")
+	tampered := sealMessage(t, nil, signKeys, "100")
+	tampered.Body = []byte("999")
+	cases := []struct {
+		name string
+		msg  *primitive.MessageExt
+		want error
+	}{
+		{"未签名", sealMessage(t, nil, nil, "100"), signing.ErrUnsigned},
+		{"签名错误", tampered, signing.ErrInvalidSignature},
+		{"未知签名密钥", sealMessage(t, nil, newTestKeys(t, "s9"), "100"), signing.ErrInvalidSignature},
+		{"未知加密密钥", sealMessage(t, newTestKeys(t, "k9"), signKeys, "100"), encryption.ErrKeyNotFound},
+	}
+	for _, c := range cases {
+		r := newTestClient(t, model.ConsumerConfig{ConsumeMode: ConsumeModeConcurrently})
+		r.SetKeyProvider(keys)
+		r.SetSignKeyProvider(signKeys)
+		errs := rejected(r)
+		called := false
+		res, _ := consumeOnce(r, func(ctx context.Context, msg *primitive.MessageExt) error {
+			called = true
+			return nil
+		}, c.msg)
+		// 被拒绝的消息不会交给handler，直接确认
+		if res != consumer.ConsumeSuccess || called {
+			t.Fatalf("%s: 期望拒绝并确认, 实际%v, handler调用:%v", c.name, res, called)
+		}
+		if len(*errs) != 1 || !errors.Is((*errs)[0], c.want) {
+			t.Fatalf("%s: 期望%v, 实际%v", c.name, c.want, *errs)
+		}
+	}
+}
+
+func TestReinitResetsSignKeys(t *testing.T) {
+	t.Setenv("KRT_SIGN_KEY_CURRENT", "S1")
+	t.Setenv("KRT_SIGN_KEY_S1", base64.StdEncoding.EncodeToString(bytes.Repeat([]byte("s"), 32)))
+	conf := newTestConfig()
+	conf.Signing = model.SigningConfig{Enable: true, KeyEnvPrefix: "KRT_SIGN_KEY_"}
+	r := &consumerClient{}
+	initTestClient(t, r, conf)
+	errs := rejected(r)
+	var calls int
+	count := func(ctx context.Context, msg *primitive.MessageExt) error {
+		calls++
+		return nil
+	}
+	consumeOnce(r, count, sealMessage(t, nil, nil, "{}"))
+	if calls != 0 || len(*errs) != 1 {
+		t.Fatalf("开启签名时未签名的消息应当被拒绝, 处理%d次, 拒绝:%v", calls, *errs)
+	}
+	r.Close()
+	initTestClient(t, r, newTestConfig())
+	consumeOnce(r, count, sealMessage(t, nil, nil, "{}"))
+	if calls != 1 || len(*errs) != 1 {
+		t.Fatalf("重新初始化后不应保留上一次配置的签名密钥, 处理%d次, 拒绝:%v", calls, *errs)
+	}
+}
+
+func TestReinitResetsEncryptionKeys(t *testing.T) {
+	setTestKeyEnv(t, "KRT_KEY_", "K1", "K2")
+	conf := newTestConfig()
+	conf.Encryption = model.EncryptionConfig{Enable: true, KeyEnvPrefix: "KRT_KEY_"}
+	r := &consumerClient{}
+	initTestClient(t, r, conf)
+	errs := rejected(r)
+	var bodies []string
+	record := func(ctx context.Context, msg *primitive.MessageExt) error {
+		bodies = append(bodies, string(msg.Body))
+		return nil
+	}
+	// 生产者轮换到K2之前用K1加密的消息同样可以解密
+	old := newTestKeys(t, "K1", "K2")
+	consumeOnce(r, record, sealMessage(t, old, nil, "before"))
+	if err := old.SetCurrent("K2"); err != nil {
+		t.Fatal(err)
+	}
+	consumeOnce(r, record, sealMessage(t, old, nil, "after"))
+	if len(*errs) != 0 || len(bodies) != 2 || bodies[0] != "before" || bodies[1] != "after" {
+		t.Fatalf("应当按消息中的keyID解密, 拒绝:%v, 处理:%v", *errs, bodies)
+	}
+	r.Close()
+	initTestClient(t, r, newTestConfig())
+	consumeOnce(r, record, sealMessage(t, old, nil, "stale"))
+	if len(bodies) != 2 || len(*errs) != 1 {
+		t.Fatalf("重新初始化后不应保留上一次配置的密钥, 拒绝:%v, 处理:%v", *errs, bodies)
+	}
+}
+
+func TestReinitResetsSchemas(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "order.json")
+	if err := os.WriteFile(file, []byte(`{"type":"object","required":["orderId"]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	conf := newTestConfig()
+	conf.Schemas = []model.SchemaConfig{{Topic: "T", File: file}}
+	conf.ConsumerConfig.ValidateSchema = true
+	r := &consumerClient{}
+	initTestClient(t, r, conf)
+	var schemaErrs []error
+	r.SetSchemaErrorHandler(func(msg *primitive.MessageExt, err error) {
+		schemaErrs = append(schemaErrs, err)
+	})
+	var bodies []string
+	record := func(ctx context.Context, msg *primitive.MessageExt) error {
+		bodies = append(bodies, string(msg.Body))
+		return nil
+	}
+	consumeOnce(r, record, sealMessage(t, nil, nil, `{"orderId":"1"}`))
+	// 未通过校验的消息交给SetSchemaErrorHandler，不会交给handler
+	res, _ := consumeOnce(r, record, sealMessage(t, nil, nil, `{}`))
+	var ve *schema.ValidationError
+	if res != consumer.ConsumeSuccess || len(bodies) != 1 || len(schemaErrs) != 1 || !errors.As(schemaErrs[0], &ve) {
+		t.Fatalf("期望校验失败的消息交给SetSchemaErrorHandler, 实际%v, 处理:%v, 校验错误:%v", res, bodies, schemaErrs)
+	}
+	r.Close()
+	initTestClient(t, r, newTestConfig())
+	consumeOnce(r, record, sealMessage(t, nil, nil, `{}`))
+	if len(bodies) != 2 || len(schemaErrs) != 1 {
+		t.Fatalf("重新初始化后不应保留上一次配置的schema, 处理:%v, 校验错误:%v", bodies, schemaErrs)
+	}
+}
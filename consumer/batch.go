@@ -0,0 +1,173 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/apache/rocketmq-client-go/v2/consumer"
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+)
+
+// BatchHandler 一次处理一批消息。返回nil表示整批成功；返回*BatchError时只有Failed中的消息需要重试；
+// 返回其它error或panic时整批重试
+type BatchHandler func(ctx context.Context, msgs []*primitive.MessageExt) error
+
+// BatchError 批量处理中部分消息失败
+type BatchError struct {
+	Failed []int // 失败消息在msgs中的下标
+	Err    error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("RocketMQ批量处理%d条消息失败:%v", len(e.Failed), e.Err)
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+// WithBatchSize 指定SubscribeBatch每次交给handler的最大消息数，默认为消费回调收到的全部消息。
+// 消费回调每次收到的消息数由consume_batch_max_size决定
+func WithBatchSize(size int) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.batchSize = size
+	}
+}
+
+// SubscribeBatch 注册批量处理函数。rocketmq-client-go v2.1.2重试时会把回调收到的消息整批发回broker，
+// 部分失败时处理成功的消息记录在本地，重新投递到本实例时直接确认，不会再交给handler。
+// Use和WithMiddleware注册的Middleware包装的是单条消息的Handler，对批量订阅不生效
+func (r *consumerClient) SubscribeBatch(topicName string, handler BatchHandler, opts ...SubscribeOption) (*Subscription, error) {
+	return r.register(&Subscription{
+		topic:     topicName,
+		batch:     handler,
+		batchSize: newSubscribeOptions(opts).batchSize,
+		acked:     newAckedSet(),
+	}, opts)
+}
+
+// ListenBatch 与SubscribeBatch相同，订阅后启动消费者，不会阻塞
+func (r *consumerClient) ListenBatch(topicName string, handler BatchHandler, opts ...SubscribeOption) (*Subscription, error) {
+	sub, err := r.SubscribeBatch(topicName, handler, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err = r.Start(); err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+// consumeBatch 按batchSize分批调用BatchHandler
+func (r *consumerClient) consumeBatch(ctx context.Context, pool *workerPool, sub *Subscription, msgs []*primitive.MessageExt) consumer.ConsumeResult {
+	var pending []*primitive.MessageExt
+	for _, v := range msgs {
+		if sub.acked.has(DedupByMsgId(v)) {
+			continue
+		}
+		if v, ok := r.accept(v); ok {
+			pending = append(pending, v)
+		}
+	}
+	size := sub.batchSize
+	if size <= 0 {
+		size = len(pending)
+	}
+	var done []*primitive.MessageExt
+	for start := 0; start < len(pending); start += size {
+		end := start + size
+		if end > len(pending) {
+			end = len(pending)
+		}
+		chunk := pending[start:end]
+		err := r.handleBatch(ctx, pool, sub.batch, chunk)
+		if err == nil {
+			done = append(done, chunk...)
+			continue
+		}
+		failed := make([]bool, len(chunk))
+		var be *BatchError
+		if errors.As(err, &be) {
+			for _, i := range be.Failed {
+				if i >= 0 && i < len(chunk) {
+					failed[i] = true
+				}
+			}
+		} else {
+			for i := range failed {
+				failed[i] = true
+			}
+		}
+		retry := false
+		for i, v := range chunk {
+			if failed[i] && !r.failed(v, err) {
+				retry = true
+				logger.Error(fmt.Sprintf("RocketMQ批量消费【%s】主题消息%s失败，稍后重试，错误:%s\n", v.Topic, v.MsgId, err.Error()))
+				continue
+			}
+			done = append(done, v)
+		}
+		if retry {
+			// 整批会重新投递，记录已处理的消息，重新投递时跳过
+			for _, v := range done {
+				sub.acked.add(DedupByMsgId(v))
+			}
+			return r.retry(ctx)
+		}
+	}
+	return consumer.ConsumeSuccess
+}
+
+// handleBatch 在协程池中执行BatchHandler，panic时转换为*PanicError
+func (r *consumerClient) handleBatch(ctx context.Context, pool *workerPool, handler BatchHandler, msgs []*primitive.MessageExt) error {
+	call := func() (err error) {
+		defer func() {
+			if e := recover(); e != nil {
+				err = recoverPanic(msgs[0], e)
+			}
+			r.countPanic(err)
+		}()
+		return handler(ctx, msgs)
+	}
+	if pool == nil {
+		return call()
+	}
+	return pool.run(call)
+}
+
+// ackedSet 部分失败时已处理成功的消息
+type ackedSet struct {
+	mu        sync.Mutex
+	keys      map[string]time.Time
+	lastSweep time.Time
+}
+
+func newAckedSet() *ackedSet {
+	return &ackedSet{keys: make(map[string]time.Time), lastSweep: time.Now()}
+}
+
+func (s *ackedSet) add(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if now.Sub(s.lastSweep) > time.Minute {
+		for k, expire := range s.keys {
+			if now.After(expire) {
+				delete(s.keys, k)
+			}
+		}
+		s.lastSweep = now
+	}
+	s.keys[key] = now.Add(DefaultDedupDoneTTL)
+}
+
+// has key存在且未过期时返回true。key保留到过期，整批多次重新投递时都会跳过
+func (s *ackedSet) has(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	expire, ok := s.keys[key]
+	return ok && time.Now().Before(expire)
+}
@@ -0,0 +1,116 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/apache/rocketmq-client-go/v2/consumer"
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+	"github.com/ketianlin/krocketmq/model"
+)
+
+// newTestBatch 创建n条MsgId为m0、m1...的消息
+func newTestBatch(n int) []*primitive.MessageExt {
+	msgs := make([]*primitive.MessageExt, n)
+	for i := range msgs {
+		msgs[i] = newTestMessage(0)
+		msgs[i].MsgId = fmt.Sprintf("m%d", i)
+	}
+	return msgs
+}
+
+// recordingBatch 记录每次交给handler的MsgId，返回handle的结果
+func recordingBatch(calls *[]string, handle func(msgs []*primitive.MessageExt) error) BatchHandler {
+	return func(ctx context.Context, msgs []*primitive.MessageExt) error {
+		var ids []string
+		for _, v := range msgs {
+			ids = append(ids, v.MsgId)
+		}
+		*calls = append(*calls, fmt.Sprint(ids))
+		return handle(msgs)
+	}
+}
+
+func TestBatchPartialFailureSkipsAcked(t *testing.T) {
+	r := newTestClient(t, model.ConsumerConfig{ConsumeMode: ConsumeModeConcurrently})
+	var calls []string
+	sub, err := r.SubscribeBatch("T", recordingBatch(&calls, func(msgs []*primitive.MessageExt) error {
+		for i, v := range msgs {
+			if v.MsgId == "m1" {
+				return &BatchError{Failed: []int{i}, Err: errHandler}
+			}
+		}
+		return nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	consume := r.consumeFunc(sub)
+	// broker每次都把整批消息重新投递，处理成功的消息只应交给handler一次
+	for i := 0; i < 3; i++ {
+		if res, _ := consume(context.Background(), newTestBatch(3)...); res != consumer.ConsumeRetryLater {
+			t.Fatalf("第%d次: 部分失败期望ConsumeRetryLater, 实际%v", i+1, res)
+		}
+	}
+	if got := fmt.Sprint(calls); got != "[[m0 m1 m2] [m1] [m1]]" {
+		t.Fatalf("已处理成功的消息不应再交给handler: %s", got)
+	}
+}
+
+func TestBatchErrorRetriesWholeBatch(t *testing.T) {
+	r := newTestClient(t, model.ConsumerConfig{ConsumeMode: ConsumeModeConcurrently})
+	var calls []string
+	sub, err := r.SubscribeBatch("T", recordingBatch(&calls, func(msgs []*primitive.MessageExt) error {
+		return errHandler
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	consume := r.consumeFunc(sub)
+	for i := 0; i < 2; i++ {
+		if res, _ := consume(context.Background(), newTestBatch(2)...); res != consumer.ConsumeRetryLater {
+			t.Fatalf("整批失败期望ConsumeRetryLater, 实际%v", res)
+		}
+	}
+	if got := fmt.Sprint(calls); got != "[[m0 m1] [m0 m1]]" {
+		t.Fatalf("非BatchError时整批重试: %s", got)
+	}
+}
+
+func TestBatchSizeAndFailedIndexes(t *testing.T) {
+	r := newTestClient(t, model.ConsumerConfig{ConsumeMode: ConsumeModeOrderly})
+	var calls []string
+	sub, err := r.SubscribeBatch("T", recordingBatch(&calls, func(msgs []*primitive.MessageExt) error {
+		// 越界的下标被忽略
+		return &BatchError{Failed: []int{-1, len(msgs)}, Err: errHandler}
+	}), WithBatchSize(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res, _ := r.consumeFunc(sub)(context.Background(), newTestBatch(5)...); res != consumer.ConsumeSuccess {
+		t.Fatalf("没有有效的失败下标时期望ConsumeSuccess, 实际%v", res)
+	}
+	if got := fmt.Sprint(calls); got != "[[m0 m1] [m2 m3] [m4]]" {
+		t.Fatalf("应当按WithBatchSize分批: %s", got)
+	}
+
+	calls = nil
+	sub, err = r.SubscribeBatch("U", recordingBatch(&calls, func(msgs []*primitive.MessageExt) error {
+		return &BatchError{Failed: []int{0}, Err: errHandler}
+	}), WithBatchSize(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := primitive.WithOrderlyCtx(context.Background(), primitive.NewConsumeOrderlyContext())
+	// 第一批失败后不再处理后面的消息，顺序消费挂起队列
+	if res, _ := r.consumeFunc(sub)(ctx, newTestBatch(4)...); res != consumer.SuspendCurrentQueueAMoment {
+		t.Fatalf("顺序消费部分失败期望SuspendCurrentQueueAMoment, 实际%v", res)
+	}
+	if got := fmt.Sprint(calls); got != "[[m0 m1]]" {
+		t.Fatalf("失败后不应继续处理: %s", got)
+	}
+	if !sub.acked.has("T:m1") || sub.acked.has("T:m0") || sub.acked.has("T:m2") {
+		t.Fatal("只应记录处理成功的消息")
+	}
+}
@@ -9,7 +9,12 @@ import (
 	"github.com/apache/rocketmq-client-go/v2/primitive"
 	"github.com/apache/rocketmq-client-go/v2/rlog"
 	"github.com/ketianlin/kgin/logs"
+	"github.com/ketianlin/krocketmq/encryption"
+	"github.com/ketianlin/krocketmq/internal/clientconf"
+	"github.com/ketianlin/krocketmq/internal/nsresolver"
 	"github.com/ketianlin/krocketmq/model"
+	"github.com/ketianlin/krocketmq/schema"
+	"github.com/ketianlin/krocketmq/signing"
 	"github.com/knadh/koanf"
 	"github.com/knadh/koanf/parsers/yaml"
 	"github.com/knadh/koanf/providers/rawbytes"
@@ -18,6 +23,7 @@ import (
 	"io/ioutil"
 	"runtime"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -27,25 +33,58 @@ type consumerClient struct {
 	conn       rocketmq.PushConsumer
 	closeError error
 	config     *model.Config
+	resolver   *nsresolver.Resolver
+	schemas    *schema.Registry
+	keys       encryption.KeyProvider
+	signKeys   signing.KeyProvider
+	// schemaErrorHandler 消息未通过JSON Schema校验时的处理，默认只记录日志
+	schemaErrorHandler func(msg *primitive.MessageExt, err error)
+	// rejectHandler 消息无法交给listener(签名校验失败、解密失败)时的处理，默认只记录日志
+	rejectHandler func(msg *primitive.MessageExt, err error)
 	//timeTicker            *time.Ticker
 	stopMqCheckTickerChan chan bool
+	mu                    sync.Mutex
+	subs                  map[string]*Subscription // 已订阅的主题
+	started               bool
+	orderly               bool          // 顺序消费，失败时挂起队列而不是ConsumeRetryLater
+	suspendTime           time.Duration // 顺序消费失败后挂起队列的时间
+	maxReconsumeTimes     int32         // 实际生效的最大重试次数
+	deadLetterHandler     DeadLetterHandler
+	panicPolicy           string // handler panic后的处理策略
+	middlewares           []Middleware
+	offsetStoreDir        string // 广播模式本地offset目录，为空时使用rocketmq-client-go的默认目录
+	pool                  *workerPool
+	panics                int64                    // handler panic的次数
+	paused                map[string]chan struct{} // 已暂停的主题，Resume时关闭channel
+	suspended             bool                     // 是否已调用PushConsumer.Suspend停止拉取
+	healthStops           []chan struct{}          // PauseWhenUnhealthy的检查协程
 }
 
+const (
+	// ConsumeModeOrderly 顺序消费：同一队列的消息逐条处理，失败时挂起队列并重试同一条消息
+	ConsumeModeOrderly = "orderly"
+	// ConsumeModeConcurrently 并发消费：消息并发处理，失败的消息由broker稍后重新投递
+	ConsumeModeConcurrently = "concurrently"
+	// MessageModelClustering 集群消费：一条消息在一个消费组中只被一个实例消费，offset保存在broker
+	MessageModelClustering = "clustering"
+	// MessageModelBroadcasting 广播消费：消费组中每个实例都收到全部消息，offset保存在本地文件
+	MessageModelBroadcasting = "broadcasting"
+	// ConsumeFromLastOffset 新消费组从队列最新位置开始消费
+	ConsumeFromLastOffset = "last_offset"
+	// ConsumeFromFirstOffset 新消费组从队列最早的消息开始消费
+	ConsumeFromFirstOffset = "first_offset"
+	// ConsumeFromTimestamp 新消费组从consume_timestamp指定的时间点开始消费
+	ConsumeFromTimestamp = "timestamp"
+	// DefaultSuspendTime 顺序消费失败后默认挂起队列的时间
+	DefaultSuspendTime = time.Second
+)
+
 var ConsumerClient = &consumerClient{}
 var logger = gologger.GetLogger()
 
 func (r *consumerClient) InitConfig(conf *model.Config, callback func(im *model.InitCallbackMessage)) {
 	if r.conn == nil {
-		// 日志级别设置
-		logLevel := r.getLogLevel(conf.ConsumerConfig.LogLevel)
-		rlog.SetLogLevel(logLevel)
-		c, err := rocketmq.NewPushConsumer(
-			consumer.WithNameServer(conf.NameServers),         // 接入点地址
-			consumer.WithConsumerModel(consumer.Clustering),   // 一条消息在一个组中只有一个consumer消费
-			consumer.WithGroupName(conf.ConsumerConfig.Group), // 分组名称
-			consumer.WithConsumerOrder(true),                  // *顺序接收 必须
-			//consumer.WithConsumeTimeout(time.Duration(conf.ConsumerConfig.Timeout)*time.Second),
-		)
+		c, err := r.newPushConsumer(conf)
 		cm := new(model.InitCallbackMessage)
 		if err != nil {
 			logger.Error(fmt.Sprintf("RocketMQ创建消费者错误:%s\n", err.Error()))
@@ -115,6 +154,22 @@ func (r *consumerClient) getLogLevel(level string) string {
 	return levelFlag
 }
 
+// readSubscriptions 读取prefix下按主题配置的过滤条件
+func (r *consumerClient) readSubscriptions(prefix string) map[string]model.SubscriptionConfig {
+	topics := r.conf.MapKeys(prefix)
+	if len(topics) == 0 {
+		return nil
+	}
+	subs := make(map[string]model.SubscriptionConfig, len(topics))
+	for _, topic := range topics {
+		subs[topic] = model.SubscriptionConfig{
+			Tag: r.conf.String(prefix + "." + topic + ".tag"),
+			Sql: r.conf.String(prefix + "." + topic + ".sql"),
+		}
+	}
+	return subs
+}
+
 func (r *consumerClient) Init(rocketmqConfigUrl string) {
 	if rocketmqConfigUrl != "" {
 		r.confUrl = rocketmqConfigUrl
@@ -125,48 +180,275 @@ func (r *consumerClient) Init(rocketmqConfigUrl string) {
 	}
 	if r.conn == nil {
 		if r.conf == nil {
-			var confData []byte
-			var err error
-			if strings.HasPrefix(r.confUrl, "http://") {
-				resp, err := grequests.Get(r.confUrl, nil)
-				if err != nil {
-					logs.Error("RocketMQ配置下载失败!{} ", err.Error())
-					return
-				}
-				confData = []byte(resp.String())
-			} else {
-				confData, err = ioutil.ReadFile(r.confUrl)
-				if err != nil {
-					logs.Error("RocketMQ本地配置文件{}读取失败:{}", r.confUrl, err.Error())
-					return
-				}
-			}
-			r.conf = koanf.New(".")
-			err = r.conf.Load(rawbytes.Provider(confData), yaml.Parser())
-			if err != nil {
-				logs.Error("RocketMQ配置解析错误:{}", err.Error())
-				r.conf = nil
+			if r.conf = loadConfig(r.confUrl); r.conf == nil {
 				return
 			}
 		}
-		nameServers := r.conf.Strings("go.rocketmq.name_servers")
-		//timeout := r.conf.Int("go.rocketmq.consumer.timeout")
-		consumerGroup := r.conf.String("go.rocketmq.consumer.group")
-		// 日志级别设置
-		logLevel := r.getLogLevel(r.conf.String("go.rocketmq.consumer.log_level"))
-		rlog.SetLogLevel(logLevel)
-		c, err := rocketmq.NewPushConsumer(
-			consumer.WithNameServer(nameServers),            // 接入点地址
-			consumer.WithConsumerModel(consumer.Clustering), // 一条消息在一个组中只有一个consumer消费
-			consumer.WithGroupName(consumerGroup),           // 分组名称
-			consumer.WithConsumerOrder(true),                // *顺序接收 必须
-			//consumer.WithConsumeTimeout(time.Duration(timeout)*time.Second),
-		)
+		conf := r.readConfig()
+		c, err := r.newPushConsumer(conf)
 		if err != nil {
 			logger.Error(fmt.Sprintf("RocketMQ创建消费者错误:%s\n", err.Error()))
 		} else {
 			r.conn = c
+			r.config = conf
+		}
+	}
+}
+
+// loadConfig 下载或读取yaml配置，失败时记录日志并返回nil
+func loadConfig(confUrl string) *koanf.Koanf {
+	var confData []byte
+	var err error
+	if strings.HasPrefix(confUrl, "http://") {
+		resp, err := grequests.Get(confUrl, nil)
+		if err != nil {
+			logs.Error("RocketMQ配置下载失败!{} ", err.Error())
+			return nil
+		}
+		confData = []byte(resp.String())
+	} else {
+		confData, err = ioutil.ReadFile(confUrl)
+		if err != nil {
+			logs.Error("RocketMQ本地配置文件{}读取失败:{}", confUrl, err.Error())
+			return nil
+		}
+	}
+	conf := koanf.New(".")
+	err = conf.Load(rawbytes.Provider(confData), yaml.Parser())
+	if err != nil {
+		logs.Error("RocketMQ配置解析错误:{}", err.Error())
+		return nil
+	}
+	return conf
+}
+
+// readConfig 将yaml配置转换为model.Config
+func (r *consumerClient) readConfig() *model.Config {
+	return &model.Config{
+		NameServers:        r.conf.Strings("go.rocketmq.name_servers"),
+		NameServerEndpoint: r.conf.String("go.rocketmq.name_server_endpoint"),
+		NameServerRefresh:  r.conf.Int("go.rocketmq.name_server_refresh"),
+		Schemas:            clientconf.ReadSchemas(r.conf, "go.rocketmq.schemas"),
+		Encryption: model.EncryptionConfig{
+			Enable:       r.conf.Bool("go.rocketmq.encryption.enable"),
+			Topics:       r.conf.Strings("go.rocketmq.encryption.topics"),
+			KeyFile:      r.conf.String("go.rocketmq.encryption.key_file"),
+			KeyEnvPrefix: r.conf.String("go.rocketmq.encryption.key_env_prefix"),
+		},
+		Signing: model.SigningConfig{
+			Enable:       r.conf.Bool("go.rocketmq.signing.enable"),
+			Properties:   r.conf.Strings("go.rocketmq.signing.properties"),
+			KeyFile:      r.conf.String("go.rocketmq.signing.key_file"),
+			KeyEnvPrefix: r.conf.String("go.rocketmq.signing.key_env_prefix"),
+		},
+		ConsumerConfig: model.ConsumerConfig{
+			Timeout:             r.conf.Int("go.rocketmq.consumer.timeout"),
+			Group:               r.conf.String("go.rocketmq.consumer.group"),
+			MonitoringTime:      r.conf.Int("go.rocketmq.consumer.monitoring_time"),
+			LogLevel:            r.conf.String("go.rocketmq.consumer.log_level"),
+			ValidateSchema:      r.conf.Bool("go.rocketmq.consumer.validate_schema"),
+			Trace:               clientconf.ReadTraceConfig(r.conf, "go.rocketmq.consumer.trace"),
+			MessageModel:        r.conf.String("go.rocketmq.consumer.message_model"),
+			OffsetStoreDir:      r.conf.String("go.rocketmq.consumer.offset_store_dir"),
+			ConsumeMode:         r.conf.String("go.rocketmq.consumer.consume_mode"),
+			ConsumeFrom:         r.conf.String("go.rocketmq.consumer.consume_from"),
+			ConsumeTimestamp:    r.conf.String("go.rocketmq.consumer.consume_timestamp"),
+			SuspendTime:         r.conf.Int("go.rocketmq.consumer.suspend_time"),
+			MaxReconsumeTimes:   r.conf.Int("go.rocketmq.consumer.max_reconsume_times"),
+			PanicPolicy:         r.conf.String("go.rocketmq.consumer.panic_policy"),
+			ConsumeBatchMaxSize: r.conf.Int("go.rocketmq.consumer.consume_batch_max_size"),
+			Concurrency:         r.conf.Int("go.rocketmq.consumer.concurrency"),
+			QueueSize:           r.conf.Int("go.rocketmq.consumer.queue_size"),
+			Subscriptions:       r.readSubscriptions("go.rocketmq.consumer.subscriptions"),
+		},
+	}
+}
+
+// prepare 推、拉消费者共用的准备工作：日志级别、密钥、schema和name server解析器
+func (r *consumerClient) prepare(conf *model.Config) (primitive.NsResolver, error) {
+	// 日志级别设置
+	logLevel := r.getLogLevel(conf.ConsumerConfig.LogLevel)
+	rlog.SetLogLevel(logLevel)
+	keys, err := encryption.LoadKeyProvider(&conf.Encryption)
+	if err != nil {
+		return nil, err
+	}
+	r.keys = keys
+	signKeys, err := signing.LoadKeyProvider(&conf.Signing)
+	if err != nil {
+		return nil, err
+	}
+	r.signKeys = signKeys
+	// 重新初始化时不保留上一次配置的schema
+	r.schemas = nil
+	if conf.ConsumerConfig.ValidateSchema {
+		schemas, err := schema.Load(conf.Schemas)
+		if err != nil {
+			return nil, err
 		}
+		r.schemas = schemas
+	}
+	var nsResolver primitive.NsResolver = primitive.NewPassthroughResolver(conf.NameServers) // 接入点地址
+	if conf.NameServerEndpoint != "" {
+		resolver, err := nsresolver.New(conf.NameServerEndpoint, time.Duration(conf.NameServerRefresh)*time.Second, conf.NameServers)
+		if err != nil {
+			return nil, err
+		}
+		r.resolver = resolver
+		nsResolver = resolver
+	}
+	return nsResolver, nil
+}
+
+// newPushConsumer Init和InitConfig共用的消费者创建逻辑
+func (r *consumerClient) newPushConsumer(conf *model.Config) (rocketmq.PushConsumer, error) {
+	nsResolver, err := r.prepare(conf)
+	if err != nil {
+		return nil, err
+	}
+	concurrency := conf.ConsumerConfig.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultConcurrency
+	}
+	orderly, err := r.isOrderly(conf.ConsumerConfig.ConsumeMode)
+	if err != nil {
+		r.stopResolver()
+		return nil, err
+	}
+	messageModel, err := r.getMessageModel(conf.ConsumerConfig.MessageModel)
+	if err != nil {
+		r.stopResolver()
+		return nil, err
+	}
+	panicPolicy, err := r.getPanicPolicy(conf.ConsumerConfig.PanicPolicy)
+	if err != nil {
+		r.stopResolver()
+		return nil, err
+	}
+	fromWhere, err := r.getConsumeFrom(conf.ConsumerConfig.ConsumeFrom)
+	if err != nil {
+		r.stopResolver()
+		return nil, err
+	}
+	suspendTime := time.Duration(conf.ConsumerConfig.SuspendTime) * time.Millisecond
+	if suspendTime <= 0 {
+		suspendTime = DefaultSuspendTime
+	}
+	opts := []consumer.Option{
+		consumer.WithNsResolver(nsResolver),
+		consumer.WithConsumerModel(messageModel),          // 集群:一条消息在一个组中只有一个consumer消费; 广播:每个consumer都消费
+		consumer.WithGroupName(conf.ConsumerConfig.Group), // 分组名称
+		consumer.WithConsumerOrder(orderly),               // 顺序消费时每个队列加锁逐条处理
+		consumer.WithConsumeGoroutineNums(concurrency),    // 每个主题同时执行的消费回调数
+		consumer.WithSuspendCurrentQueueTimeMillis(suspendTime),
+		consumer.WithConsumeFromWhere(fromWhere), // 新消费组首次消费的起始位置，已有offset的消费组不受影响
+		//consumer.WithConsumeTimeout(time.Duration(conf.ConsumerConfig.Timeout)*time.Second),
+	}
+	if size := conf.ConsumerConfig.ConsumeBatchMaxSize; size > 0 {
+		if size > 1024 {
+			r.stopResolver()
+			return nil, fmt.Errorf("RocketMQ consume_batch_max_size %d超出范围，最大1024", size)
+		}
+		opts = append(opts, consumer.WithConsumeMessageBatchMaxSize(size))
+	}
+	if conf.ConsumerConfig.MaxReconsumeTimes > 0 {
+		opts = append(opts, consumer.WithMaxReconsumeTimes(int32(conf.ConsumerConfig.MaxReconsumeTimes)))
+	}
+	if fromWhere == consumer.ConsumeFromTimestamp {
+		t, err := ParseConsumeTimestamp(conf.ConsumerConfig.ConsumeTimestamp, time.Now())
+		if err != nil {
+			r.stopResolver()
+			return nil, err
+		}
+		// rocketmq-client-go按UTC解析该格式
+		opts = append(opts, consumer.WithConsumeTimestamp(t.UTC().Format("20060102150405")))
+	}
+	traceConfig, err := clientconf.TraceConfig(conf.ConsumerConfig.Trace, conf.ConsumerConfig.Group, nsResolver)
+	if err != nil {
+		r.stopResolver()
+		return nil, err
+	}
+	if traceConfig != nil {
+		opts = append(opts, consumer.WithTrace(traceConfig))
+	}
+	c, err := rocketmq.NewPushConsumer(opts...)
+	if err != nil {
+		r.stopResolver()
+		return nil, err
+	}
+	r.orderly = orderly
+	r.offsetStoreDir = ""
+	if messageModel == consumer.BroadCasting {
+		r.offsetStoreDir = conf.ConsumerConfig.OffsetStoreDir
+	}
+	r.suspendTime = suspendTime
+	r.maxReconsumeTimes = r.maxReconsume(conf.ConsumerConfig.MaxReconsumeTimes)
+	r.panicPolicy = panicPolicy
+	r.pool = newWorkerPool(concurrency, conf.ConsumerConfig.QueueSize)
+	return c, nil
+}
+
+// getMessageModel 解析消息模式，默认集群消费
+func (r *consumerClient) getMessageModel(name string) (consumer.MessageModel, error) {
+	switch strings.ToLower(name) {
+	case "", MessageModelClustering:
+		return consumer.Clustering, nil
+	case MessageModelBroadcasting:
+		return consumer.BroadCasting, nil
+	}
+	return consumer.Clustering, fmt.Errorf("RocketMQ消息模式%s错误，只支持%s和%s", name, MessageModelClustering, MessageModelBroadcasting)
+}
+
+// getConsumeFrom 解析首次消费的起始位置，默认从最新offset开始
+func (r *consumerClient) getConsumeFrom(from string) (consumer.ConsumeFromWhere, error) {
+	switch strings.ToLower(from) {
+	case "", ConsumeFromLastOffset:
+		return consumer.ConsumeFromLastOffset, nil
+	case ConsumeFromFirstOffset:
+		return consumer.ConsumeFromFirstOffset, nil
+	case ConsumeFromTimestamp:
+		return consumer.ConsumeFromTimestamp, nil
+	}
+	return consumer.ConsumeFromLastOffset, fmt.Errorf("RocketMQ消费起始位置%s错误，只支持%s、%s和%s", from, ConsumeFromLastOffset, ConsumeFromFirstOffset, ConsumeFromTimestamp)
+}
+
+// ParseConsumeTimestamp 解析consume_timestamp：RFC3339时间(如2024-01-02T15:04:05+08:00)，
+// 或相对now的时长(如-2h、-30m)
+func ParseConsumeTimestamp(value string, now time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, errors.New("RocketMQ从时间点开始消费时consume_timestamp不能为空")
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("RocketMQ consume_timestamp %s格式错误，需要RFC3339时间或-2h这样的相对时长", value)
+	}
+	return now.Add(d), nil
+}
+
+// isOrderly 解析消费模式，默认顺序消费
+func (r *consumerClient) isOrderly(mode string) (bool, error) {
+	switch strings.ToLower(mode) {
+	case "", ConsumeModeOrderly:
+		return true, nil
+	case ConsumeModeConcurrently:
+		return false, nil
+	}
+	return false, fmt.Errorf("RocketMQ消费模式%s错误，只支持%s和%s", mode, ConsumeModeOrderly, ConsumeModeConcurrently)
+}
+
+// Orderly 是否为顺序消费
+func (r *consumerClient) Orderly() bool {
+	return r.orderly
+}
+
+func (r *consumerClient) stopResolver() {
+	if r.resolver != nil {
+		r.resolver.Stop()
+		r.resolver = nil
 	}
 }
 
@@ -179,6 +461,7 @@ func (r *consumerClient) Close() {
 		if r.stopMqCheckTickerChan != nil {
 			r.stopMqCheckTickerChan <- true
 			close(r.stopMqCheckTickerChan)
+			r.stopMqCheckTickerChan = nil
 		}
 		if e := recover(); e != nil {
 			switch e := e.(type) {
@@ -193,7 +476,13 @@ func (r *consumerClient) Close() {
 			}
 		}
 	}()
-	if r.conn != nil {
+	// Shutdown失败时也要停止地址服务的刷新协程
+	defer r.stopResolver()
+	r.mu.Lock()
+	started := r.started
+	r.mu.Unlock()
+	// 未Start的PushConsumer调用Shutdown会空指针，直接丢弃即可
+	if r.conn != nil && started {
 		err := r.conn.Shutdown()
 		if err != nil {
 			logger.Error(fmt.Sprintf("RocketMQ关闭消费者client错误:%s\n", err.Error()))
@@ -201,39 +490,27 @@ func (r *consumerClient) Close() {
 			return
 		}
 	}
+	if r.pool != nil {
+		r.pool.stop()
+		r.pool = nil
+	}
+	r.mu.Lock()
+	for _, stop := range r.healthStops {
+		close(stop)
+	}
+	r.healthStops = nil
+	r.finishAll(ErrConsumerClosed)
+	r.started = false
+	r.paused, r.suspended = nil, false
+	r.mu.Unlock()
 	r.conn = nil
 }
 
 func (r *consumerClient) MessageListener(topicName string, listener func(msg []byte), callbacks ...func(err error)) {
-	err := r.conn.Subscribe(topicName, consumer.MessageSelector{}, func(ctx context.Context, msg ...*primitive.MessageExt) (consumer.ConsumeResult, error) {
-		for _, v := range msg {
-			//fmt.Println("收到：", string(v.Body)) // v.Body : 消息主体
-			go listener(v.Body)
-		}
-		return consumer.ConsumeSuccess, nil
-	})
-	if err != nil {
-		logger.Error(fmt.Sprintf("RocketMQ消费者订阅【%s】主题失败，错误:%s\n", topicName, err.Error()))
-		if len(callbacks) > 0 {
-			callbacks[0](err)
-		}
-	}
-	forever := make(chan bool)
-	err = r.conn.Start()
-	if err != nil {
-		//defer func(conn rocketmq.PushConsumer) {
-		//
-		//}(r.conn)
-		err := r.conn.Shutdown()
-		if err != nil {
-			logger.Error(fmt.Sprintf("RocketMQ消费者订阅【%s】主题错误后关闭:%s\n", topicName, err.Error()))
-			if len(callbacks) > 0 {
-				callbacks[0](err)
-			}
-		}
-		//log.Fatal(err)
-	}
-	<-forever
+	r.listen(topicName, func(ctx context.Context, msg *primitive.MessageExt) error {
+		listener(msg.Body)
+		return nil
+	}, true, callbacks...)
 }
 
 func (r *consumerClient) MessageListenerReturnFullMessage(topicName string, listener func(msg *primitive.MessageExt), callbacks ...func(err error)) {
@@ -241,6 +518,7 @@ func (r *consumerClient) MessageListenerReturnFullMessage(topicName string, list
 		if r.stopMqCheckTickerChan != nil {
 			r.stopMqCheckTickerChan <- true
 			close(r.stopMqCheckTickerChan)
+			r.stopMqCheckTickerChan = nil
 		}
 		if e := recover(); e != nil {
 			switch e := e.(type) {
@@ -258,65 +536,122 @@ func (r *consumerClient) MessageListenerReturnFullMessage(topicName string, list
 			}
 		}
 	}()
-	err := r.conn.Subscribe(topicName, consumer.MessageSelector{}, func(ctx context.Context, msg ...*primitive.MessageExt) (consumer.ConsumeResult, error) {
-		for _, v := range msg {
-			go listener(v)
-		}
-		return consumer.ConsumeSuccess, nil
-	})
-	if err != nil {
-		logger.Error(fmt.Sprintf("RocketMQ消费者订阅【%s】主题失败，错误:%s\n", topicName, err.Error()))
-		if len(callbacks) > 0 {
-			callbacks[0](err)
+	r.listen(topicName, func(ctx context.Context, msg *primitive.MessageExt) error {
+		listener(msg)
+		return nil
+	}, true, callbacks...)
+}
+
+func (r *consumerClient) MessageListenerNew(topicName string, listener func(topicName string, msg []byte), callbacks ...func(err error)) {
+	r.listen(topicName, func(ctx context.Context, msg *primitive.MessageExt) error {
+		listener(topicName, msg.Body)
+		return nil
+	}, true, callbacks...)
+}
+
+// MessageHandler 与MessageListener相同，但listener在消费回调中同步执行，
+// 返回error或panic时消息稍后重新投递
+func (r *consumerClient) MessageHandler(topicName string, listener func(msg []byte) error, callbacks ...func(err error)) {
+	r.listen(topicName, func(ctx context.Context, msg *primitive.MessageExt) error {
+		return listener(msg.Body)
+	}, false, callbacks...)
+}
+
+// MessageHandlerReturnFullMessage 与MessageHandler相同，listener接收完整消息
+func (r *consumerClient) MessageHandlerReturnFullMessage(topicName string, listener func(msg *primitive.MessageExt) error, callbacks ...func(err error)) {
+	r.listen(topicName, func(ctx context.Context, msg *primitive.MessageExt) error {
+		return listener(msg)
+	}, false, callbacks...)
+}
+
+// SetSchemaRegistry 设置接收时使用的JSON Schema注册表，覆盖配置中加载的schema
+func (r *consumerClient) SetSchemaRegistry(registry *schema.Registry) {
+	r.schemas = registry
+}
+
+// SetSchemaErrorHandler 设置消息未通过JSON Schema校验时的处理函数，未通过校验的消息不会交给listener
+func (r *consumerClient) SetSchemaErrorHandler(handler func(msg *primitive.MessageExt, err error)) {
+	r.schemaErrorHandler = handler
+}
+
+// SetKeyProvider 设置解密使用的KeyProvider，覆盖配置中加载的密钥
+func (r *consumerClient) SetKeyProvider(provider encryption.KeyProvider) {
+	r.keys = provider
+}
+
+// SetSignKeyProvider 设置校验签名使用的KeyProvider，设置后未签名或签名错误的消息都会被拒绝
+func (r *consumerClient) SetSignKeyProvider(provider signing.KeyProvider) {
+	r.signKeys = provider
+}
+
+// SetRejectHandler 设置消息无法交给listener(签名校验失败、解密失败)时的处理函数
+func (r *consumerClient) SetRejectHandler(handler func(msg *primitive.MessageExt, err error)) {
+	r.rejectHandler = handler
+}
+
+// accept 消息交给listener之前的处理：签名校验、解密、JSON Schema校验，返回false时消息不会交给listener。
+// 加密消息在副本上解密并返回副本：rocketmq-client-go重试时会再次投递同一个对象，原消息必须保持密文和签名不变
+func (r *consumerClient) accept(msg *primitive.MessageExt) (*primitive.MessageExt, bool) {
+	if r.signKeys != nil {
+		if err := signing.Verify(r.signKeys, msg); err != nil {
+			r.reject(msg, err)
+			return nil, false
 		}
 	}
-	forever := make(chan bool)
-	err = r.conn.Start()
-	if err != nil {
-		errAll := err
-		err2 := r.conn.Shutdown()
-		if err2 != nil {
-			errAll = errors.Join(errAll, err2)
-		}
-		logger.Error(fmt.Sprintf("RocketMQ消费者订阅【%s】主题错误后关闭:%s\n", topicName, errAll.Error()))
-		if len(callbacks) > 0 {
-			callbacks[0](err)
+	if encryption.IsEncrypted(&msg.Message) {
+		plain := cloneMessage(msg)
+		if err := encryption.Decrypt(r.keys, plain); err != nil {
+			r.reject(msg, err)
+			return nil, false
 		}
+		msg = plain
 	}
-	<-forever
+	return msg, r.checkSchema(msg)
 }
 
-func (r *consumerClient) MessageListenerNew(topicName string, listener func(topicName string, msg []byte), callbacks ...func(err error)) {
-	err := r.conn.Subscribe(topicName, consumer.MessageSelector{}, func(ctx context.Context, msg ...*primitive.MessageExt) (consumer.ConsumeResult, error) {
-		for _, v := range msg {
-			//fmt.Println("收到：", string(v.Body)) // v.Body : 消息主体
-			go listener(topicName, v.Body)
-		}
-		return consumer.ConsumeSuccess, nil
-	})
-	if err != nil {
-		logger.Error(fmt.Sprintf("RocketMQ消费者订阅【%s】主题失败，错误:%s\n", topicName, err.Error()))
-		if len(callbacks) > 0 {
-			callbacks[0](err)
-		}
+// cloneMessage 复制消息，属性复制为新的map
+func cloneMessage(msg *primitive.MessageExt) *primitive.MessageExt {
+	c := &primitive.MessageExt{
+		MsgId:                     msg.MsgId,
+		OffsetMsgId:               msg.OffsetMsgId,
+		StoreSize:                 msg.StoreSize,
+		QueueOffset:               msg.QueueOffset,
+		SysFlag:                   msg.SysFlag,
+		BornTimestamp:             msg.BornTimestamp,
+		BornHost:                  msg.BornHost,
+		StoreTimestamp:            msg.StoreTimestamp,
+		StoreHost:                 msg.StoreHost,
+		CommitLogOffset:           msg.CommitLogOffset,
+		BodyCRC:                   msg.BodyCRC,
+		ReconsumeTimes:            msg.ReconsumeTimes,
+		PreparedTransactionOffset: msg.PreparedTransactionOffset,
 	}
-	forever := make(chan bool)
-	err = r.conn.Start()
-	if err != nil {
-		err2 := r.conn.Shutdown()
-		errAll := err
-		if err2 != nil {
-			errAll = errors.Join(errAll, err2)
-		}
-		errMsg := fmt.Sprintf("RocketMQ消费者启动监听【%s】主题失败:%s\n", topicName, errAll.Error())
-		logger.Error(errMsg)
-		if len(callbacks) > 0 {
-			callbacks[0](err)
-		}
-		//log.Fatal(errors.New(errMsg))
+	c.Topic, c.Body, c.CompressedBody, c.Flag = msg.Topic, msg.Body, msg.CompressedBody, msg.Flag
+	c.TransactionId, c.Batch, c.Compress, c.Queue = msg.TransactionId, msg.Batch, msg.Compress, msg.Queue
+	c.WithProperties(msg.GetProperties())
+	return c
+}
+
+func (r *consumerClient) reject(msg *primitive.MessageExt, err error) {
+	if r.rejectHandler != nil {
+		r.rejectHandler(msg, err)
+	} else {
+		logger.Error(fmt.Sprintf("RocketMQ消息%s被拒绝:%s\n", msg.MsgId, err.Error()))
+	}
+}
+
+// checkSchema 校验消息体，未通过时交给schemaErrorHandler并返回false
+func (r *consumerClient) checkSchema(msg *primitive.MessageExt) bool {
+	err := r.schemas.Validate(msg.Topic, msg.GetTags(), msg.Body)
+	if err == nil {
+		return true
+	}
+	if r.schemaErrorHandler != nil {
+		r.schemaErrorHandler(msg, err)
+	} else {
+		logger.Error(fmt.Sprintf("%s, MsgId:%s\n", err.Error(), msg.MsgId))
 	}
-	<-forever
-	close(forever)
+	return false
 }
 
 func (r *consumerClient) MqCheck() (err error) {
@@ -0,0 +1,229 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/apache/rocketmq-client-go/v2/consumer"
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+	"github.com/ketianlin/krocketmq/model"
+)
+
+var errHandler = errors.New("处理失败")
+
+func newTestConfig() *model.Config {
+	return &model.Config{
+		NameServers: []string{"127.0.0.1:9876"},
+		ConsumerConfig: model.ConsumerConfig{
+			Group:          "testConsumerGroup",
+			LogLevel:       "fatal",
+			MonitoringTime: 3600,
+		},
+	}
+}
+
+// newTestClient 按cc创建未启动的消费者，测试结束时关闭
+func newTestClient(t *testing.T, cc model.ConsumerConfig) *consumerClient {
+	t.Helper()
+	conf := newTestConfig()
+	group := conf.ConsumerConfig.Group
+	conf.ConsumerConfig = cc
+	conf.ConsumerConfig.Group, conf.ConsumerConfig.LogLevel, conf.ConsumerConfig.MonitoringTime = group, "fatal", 3600
+	r := &consumerClient{}
+	r.InitConfig(conf, func(im *model.InitCallbackMessage) {
+		if im.InitError != nil {
+			t.Fatal(im.InitError)
+		}
+	})
+	t.Cleanup(r.Close)
+	return r
+}
+
+func newTestMessage(reconsumeTimes int32) *primitive.MessageExt {
+	msg := &primitive.MessageExt{MsgId: "m1", ReconsumeTimes: reconsumeTimes}
+	msg.Topic = "T"
+	return msg
+}
+
+// consumeOnce 用handler处理一条消息，返回消费结果；orderly时ctx携带ConsumeOrderlyContext
+func consumeOnce(r *consumerClient, handler Handler, msg *primitive.MessageExt) (consumer.ConsumeResult, *primitive.ConsumeOrderlyContext) {
+	ctx := context.Background()
+	oc := primitive.NewConsumeOrderlyContext()
+	if r.orderly {
+		ctx = primitive.WithOrderlyCtx(ctx, oc)
+	}
+	res, _ := r.consumeFunc(&Subscription{topic: msg.Topic, handler: handler})(ctx, msg)
+	return res, oc
+}
+
+func failing(ctx context.Context, msg *primitive.MessageExt) error {
+	return errHandler
+}
+
+func TestOrderlyFailureSuspendsQueue(t *testing.T) {
+	r := newTestClient(t, model.ConsumerConfig{ConsumeMode: ConsumeModeOrderly, SuspendTime: 2500})
+	res, oc := consumeOnce(r, failing, newTestMessage(0))
+	if res != consumer.SuspendCurrentQueueAMoment {
+		t.Fatalf("顺序消费失败期望SuspendCurrentQueueAMoment, 实际%v", res)
+	}
+	if oc.SuspendCurrentQueueTimeMillis != 2500 {
+		t.Fatalf("期望挂起2500ms, 实际%d", oc.SuspendCurrentQueueTimeMillis)
+	}
+	res, oc = consumeOnce(r, func(ctx context.Context, msg *primitive.MessageExt) error { return nil }, newTestMessage(0))
+	if res != consumer.ConsumeSuccess || oc.SuspendCurrentQueueTimeMillis != -1 {
+		t.Fatalf("处理成功时不应挂起队列: %v, %d", res, oc.SuspendCurrentQueueTimeMillis)
+	}
+}
+
+func TestConcurrentFailureRetriesLater(t *testing.T) {
+	r := newTestClient(t, model.ConsumerConfig{ConsumeMode: ConsumeModeConcurrently})
+	if res, _ := consumeOnce(r, failing, newTestMessage(0)); res != consumer.ConsumeRetryLater {
+		t.Fatalf("并发消费失败期望ConsumeRetryLater, 实际%v", res)
+	}
+	// async的旧版listener在并发消费时提交后立即确认
+	sub := &Subscription{topic: "T", async: true, handler: failing}
+	if res, _ := r.consumeFunc(sub)(context.Background(), newTestMessage(0)); res != consumer.ConsumeSuccess {
+		t.Fatalf("async listener期望ConsumeSuccess, 实际%v", res)
+	}
+}
+
+func TestDeadLetterOnFinalAttempt(t *testing.T) {
+	cases := []struct {
+		mode    string
+		retry   consumer.ConsumeResult
+		notLast int32 // 还会重试的ReconsumeTimes
+		last    int32 // 最后一次处理的ReconsumeTimes
+	}{
+		// 并发消费ReconsumeTimes达到上限后broker转入死信队列
+		{ConsumeModeConcurrently, consumer.ConsumeRetryLater, 2, 3},
+		// 顺序消费由客户端计数，超过上限后才发回broker
+		{ConsumeModeOrderly, consumer.SuspendCurrentQueueAMoment, 3, 4},
+	}
+	for _, c := range cases {
+		r := newTestClient(t, model.ConsumerConfig{ConsumeMode: c.mode, MaxReconsumeTimes: 3})
+		var got []*primitive.MessageExt
+		var hookErr error
+		r.OnDeadLetter(func(msg *primitive.MessageExt, err error) error {
+			got = append(got, msg)
+			if !errors.Is(err, errHandler) {
+				t.Fatalf("%s: 死信处理应收到handler的错误, 实际%v", c.mode, err)
+			}
+			return hookErr
+		})
+		if res, _ := consumeOnce(r, failing, newTestMessage(c.notLast)); res != c.retry || len(got) != 0 {
+			t.Fatalf("%s: 未到最后一次期望%v且不调用死信处理, 实际%v, 调用%d次", c.mode, c.retry, res, len(got))
+		}
+		if res, _ := consumeOnce(r, failing, newTestMessage(c.last)); res != consumer.ConsumeSuccess || len(got) != 1 {
+			t.Fatalf("%s: 最后一次失败期望死信处理后确认, 实际%v, 调用%d次", c.mode, res, len(got))
+		}
+		// 死信处理失败时按默认流程交给broker
+		hookErr = errors.New("暂存失败")
+		if res, _ := consumeOnce(r, failing, newTestMessage(c.last)); res != c.retry || len(got) != 2 {
+			t.Fatalf("%s: 死信处理失败期望%v, 实际%v", c.mode, c.retry, res)
+		}
+	}
+}
+
+func TestMaxReconsumeTimes(t *testing.T) {
+	cases := []struct {
+		mode       string
+		configured int
+		want       int32
+	}{
+		{ConsumeModeConcurrently, 0, DefaultMaxReconsumeTimes},
+		{ConsumeModeOrderly, 0, math.MaxInt32},
+		{ConsumeModeConcurrently, 5, 5},
+		{ConsumeModeOrderly, 5, 5},
+	}
+	for _, c := range cases {
+		r := newTestClient(t, model.ConsumerConfig{ConsumeMode: c.mode, MaxReconsumeTimes: c.configured})
+		if r.maxReconsumeTimes != c.want {
+			t.Fatalf("%s配置%d: 期望最大重试%d次, 实际%d", c.mode, c.configured, c.want, r.maxReconsumeTimes)
+		}
+	}
+}
+
+func TestRetryLimitWithDefaults(t *testing.T) {
+	var calls int
+	hook := func(msg *primitive.MessageExt, err error) error {
+		calls++
+		return nil
+	}
+	// 并发消费默认第16次重试为最后一次
+	r := newTestClient(t, model.ConsumerConfig{ConsumeMode: ConsumeModeConcurrently})
+	r.OnDeadLetter(hook)
+	if res, _ := consumeOnce(r, failing, newTestMessage(DefaultMaxReconsumeTimes-1)); res != consumer.ConsumeRetryLater || calls != 0 {
+		t.Fatalf("第15次重试失败应继续重试, 实际%v, 死信%d次", res, calls)
+	}
+	if res, _ := consumeOnce(r, failing, newTestMessage(DefaultMaxReconsumeTimes)); res != consumer.ConsumeSuccess || calls != 1 {
+		t.Fatalf("第16次重试失败应进入死信处理, 实际%v, 死信%d次", res, calls)
+	}
+	// 顺序消费默认不限次数，一直挂起队列重试
+	r = newTestClient(t, model.ConsumerConfig{ConsumeMode: ConsumeModeOrderly})
+	r.OnDeadLetter(hook)
+	if res, _ := consumeOnce(r, failing, newTestMessage(1000)); res != consumer.SuspendCurrentQueueAMoment || calls != 1 {
+		t.Fatalf("顺序消费默认不应进入死信处理, 实际%v, 死信%d次", res, calls)
+	}
+}
+
+func panicking(ctx context.Context, msg *primitive.MessageExt) error {
+	panic("boom")
+}
+
+func TestPanicPolicies(t *testing.T) {
+	cases := []struct {
+		policy   string
+		reTimes  int32
+		hookErr  error
+		want     consumer.ConsumeResult
+		deadCall int
+	}{
+		{PanicPolicyRetry, 0, nil, consumer.ConsumeRetryLater, 0},
+		{PanicPolicyAck, 0, nil, consumer.ConsumeSuccess, 0},
+		{PanicPolicyDeadLetter, 0, nil, consumer.ConsumeSuccess, 1},
+		// 死信处理失败时重新投递
+		{PanicPolicyDeadLetter, 0, errors.New("暂存失败"), consumer.ConsumeRetryLater, 1},
+		// 最后一次重试时死信处理失败，同样只调用一次
+		{PanicPolicyDeadLetter, DefaultMaxReconsumeTimes, errors.New("暂存失败"), consumer.ConsumeRetryLater, 1},
+	}
+	for _, c := range cases {
+		r := newTestClient(t, model.ConsumerConfig{ConsumeMode: ConsumeModeConcurrently, PanicPolicy: c.policy})
+		var calls int
+		r.OnDeadLetter(func(msg *primitive.MessageExt, err error) error {
+			calls++
+			var pe *PanicError
+			if !errors.As(err, &pe) || pe.Value != "boom" || len(pe.Stack) == 0 {
+				t.Fatalf("%s: 死信处理应收到*PanicError, 实际%v", c.policy, err)
+			}
+			return c.hookErr
+		})
+		res, _ := consumeOnce(r, panicking, newTestMessage(c.reTimes))
+		if res != c.want || calls != c.deadCall {
+			t.Fatalf("%s: 期望%v且死信处理%d次, 实际%v, %d次", c.policy, c.want, c.deadCall, res, calls)
+		}
+		if r.PanicCount() != 1 {
+			t.Fatalf("%s: 期望panic计数1, 实际%d", c.policy, r.PanicCount())
+		}
+	}
+}
+
+func TestPanicRetryPolicyOrderly(t *testing.T) {
+	r := newTestClient(t, model.ConsumerConfig{ConsumeMode: ConsumeModeOrderly})
+	res, oc := consumeOnce(r, panicking, newTestMessage(0))
+	if res != consumer.SuspendCurrentQueueAMoment || oc.SuspendCurrentQueueTimeMillis != int(DefaultSuspendTime.Milliseconds()) {
+		t.Fatalf("顺序消费panic期望挂起队列, 实际%v, %d", res, oc.SuspendCurrentQueueTimeMillis)
+	}
+}
+
+func TestPanicCountPerClient(t *testing.T) {
+	a := newTestClient(t, model.ConsumerConfig{ConsumeMode: ConsumeModeConcurrently})
+	b := newTestClient(t, model.ConsumerConfig{ConsumeMode: ConsumeModeConcurrently})
+	consumeOnce(a, panicking, newTestMessage(0))
+	// Recovery Middleware恢复的panic同样计数，且只计一次
+	consumeOnce(a, Recovery()(panicking), newTestMessage(0))
+	if a.PanicCount() != 2 || b.PanicCount() != 0 {
+		t.Fatalf("panic计数应按消费者统计, 实际a=%d, b=%d", a.PanicCount(), b.PanicCount())
+	}
+}
@@ -0,0 +1,65 @@
+package consumer
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+)
+
+const (
+	// DefaultMaxReconsumeTimes 并发消费未配置max_reconsume_times时broker的默认重试次数
+	DefaultMaxReconsumeTimes = 16
+)
+
+// DeadLetterHandler 消息最后一次处理仍失败时调用，err为最后一次的错误。
+// 返回nil表示已经处理(如转发到暂存主题或写入本地存储)，消息被确认；
+// 返回error时消息按默认流程交给broker，进入死信队列
+type DeadLetterHandler func(msg *primitive.MessageExt, err error) error
+
+// OnDeadLetter 设置消息达到最大重试次数后的处理函数
+func (r *consumerClient) OnDeadLetter(handler DeadLetterHandler) {
+	r.deadLetterHandler = handler
+}
+
+// maxReconsume 根据配置计算实际的最大重试次数，与rocketmq-client-go的默认值保持一致：
+// 并发消费默认16次，顺序消费默认不限次数
+func (r *consumerClient) maxReconsume(configured int) int32 {
+	if configured > 0 {
+		return int32(configured)
+	}
+	if r.orderly {
+		return math.MaxInt32
+	}
+	return DefaultMaxReconsumeTimes
+}
+
+// finalAttempt msg本次处理是否为最后一次。并发消费时ReconsumeTimes达到上限后broker将其转入死信队列；
+// 顺序消费由客户端计数，超过上限后才发回broker
+func (r *consumerClient) finalAttempt(msg *primitive.MessageExt) bool {
+	if r.orderly {
+		return msg.ReconsumeTimes > r.maxReconsumeTimes
+	}
+	return msg.ReconsumeTimes >= r.maxReconsumeTimes
+}
+
+// deadLetter 最后一次处理失败时调用DeadLetterHandler，返回true表示消息可以确认
+func (r *consumerClient) deadLetter(msg *primitive.MessageExt, err error) bool {
+	if !r.finalAttempt(msg) {
+		return false
+	}
+	return r.callDeadLetter(msg, err)
+}
+
+// callDeadLetter 调用DeadLetterHandler，未设置或处理失败时返回false
+func (r *consumerClient) callDeadLetter(msg *primitive.MessageExt, err error) bool {
+	handler := r.deadLetterHandler
+	if handler == nil {
+		return false
+	}
+	if herr := handler(msg, err); herr != nil {
+		logger.Error(fmt.Sprintf("RocketMQ处理【%s】主题死信消息%s失败，交由broker处理，错误:%s\n", msg.Topic, msg.MsgId, herr.Error()))
+		return false
+	}
+	return true
+}
@@ -0,0 +1,129 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+)
+
+// DedupState 去重key的状态
+type DedupState int
+
+const (
+	// DedupAcquired key之前不存在(或已过期)，已被当前调用标记为处理中
+	DedupAcquired DedupState = iota
+	// DedupInProgress 其他协程或实例正在处理该消息
+	DedupInProgress
+	// DedupDone 该消息已经处理成功
+	DedupDone
+)
+
+const (
+	// DefaultDedupProcessingTTL 处理中标记的默认有效期，处理者崩溃后标记过期，消息可以再次处理
+	DefaultDedupProcessingTTL = 5 * time.Minute
+	// DefaultDedupDoneTTL 处理完成标记的默认有效期，应大于消息可能重复投递的时间窗口
+	DefaultDedupDoneTTL = 24 * time.Hour
+)
+
+// ErrDedupInProgress 同一条消息正在被其他协程或实例处理，稍后重试
+var ErrDedupInProgress = errors.New("RocketMQ消息正在处理中")
+
+// DedupStore 保存消息的处理状态。实现必须保证Acquire的检查和标记是原子的
+type DedupStore interface {
+	// Acquire key不存在或已过期时标记为处理中并返回DedupAcquired，否则返回key当前的状态
+	Acquire(ctx context.Context, key string, ttl time.Duration) (DedupState, error)
+	// Done 将key标记为处理完成，ttl后过期
+	Done(ctx context.Context, key string, ttl time.Duration) error
+	// Release 处理失败时删除处理中标记，消息重新投递后可以再次处理
+	Release(ctx context.Context, key string) error
+}
+
+// DedupOption 去重选项
+type DedupOption func(o *dedupOptions)
+
+type dedupOptions struct {
+	key           func(msg *primitive.MessageExt) string
+	processingTTL time.Duration
+	doneTTL       time.Duration
+}
+
+// DedupByMsgId 按消息唯一ID去重(默认)。优先使用生产者生成的UNIQ_KEY，重试消息的UNIQ_KEY不变
+func DedupByMsgId(msg *primitive.MessageExt) string {
+	if id := msg.GetProperty(primitive.PropertyUniqueClientMessageIdKeyIndex); id != "" {
+		return msg.Topic + ":" + id
+	}
+	return msg.Topic + ":" + msg.MsgId
+}
+
+// DedupByKeys 按消息的keys去重，没有keys的消息不去重
+func DedupByKeys(msg *primitive.MessageExt) string {
+	if keys := msg.GetKeys(); keys != "" {
+		return msg.Topic + ":" + keys
+	}
+	return ""
+}
+
+// WithDedupKey 指定去重key的提取方式，返回空字符串的消息不去重
+func WithDedupKey(key func(msg *primitive.MessageExt) string) DedupOption {
+	return func(o *dedupOptions) {
+		o.key = key
+	}
+}
+
+// WithDedupTTL 指定处理中和处理完成标记的有效期
+func WithDedupTTL(processing, done time.Duration) DedupOption {
+	return func(o *dedupOptions) {
+		o.processingTTL = processing
+		o.doneTTL = done
+	}
+}
+
+// Dedup 幂等消费Middleware：已处理成功的消息直接确认，正在处理的消息稍后重试，
+// handler失败或panic时删除处理中标记，消息重新投递后再次处理
+func Dedup(store DedupStore, opts ...DedupOption) Middleware {
+	o := &dedupOptions{key: DedupByMsgId, processingTTL: DefaultDedupProcessingTTL, doneTTL: DefaultDedupDoneTTL}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return func(next Handler) Handler {
+		return func(ctx context.Context, msg *primitive.MessageExt) error {
+			key := o.key(msg)
+			if key == "" {
+				return next(ctx, msg)
+			}
+			state, err := store.Acquire(ctx, key, o.processingTTL)
+			if err != nil {
+				return fmt.Errorf("RocketMQ消息去重状态查询失败:%w", err)
+			}
+			switch state {
+			case DedupDone:
+				logger.Debug(fmt.Sprintf("RocketMQ【%s】主题消息%s已处理，跳过重复消息\n", msg.Topic, key))
+				return nil
+			case DedupInProgress:
+				return ErrDedupInProgress
+			}
+			succeeded := false
+			defer func() {
+				// handler失败或panic时删除处理中标记，panic继续向外抛出
+				if succeeded {
+					return
+				}
+				if rerr := store.Release(ctx, key); rerr != nil {
+					logger.Error(fmt.Sprintf("RocketMQ删除消息%s的处理中标记失败:%s\n", key, rerr.Error()))
+				}
+			}()
+			if err = next(ctx, msg); err != nil {
+				return err
+			}
+			succeeded = true
+			if derr := store.Done(ctx, key, o.doneTTL); derr != nil {
+				// 消息已处理成功，不再重试，只是之后的重复消息无法识别
+				logger.Error(fmt.Sprintf("RocketMQ标记消息%s处理完成失败:%s\n", key, derr.Error()))
+			}
+			return nil
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+)
+
+// Middleware 包装Handler，在handler前后增加日志、监控、去重、超时等逻辑
+type Middleware func(next Handler) Handler
+
+// Chain 将多个Middleware组合为一个，第一个在最外层
+func Chain(middlewares ...Middleware) Middleware {
+	return func(next Handler) Handler {
+		for i := len(middlewares) - 1; i >= 0; i-- {
+			next = middlewares[i](next)
+		}
+		return next
+	}
+}
+
+// Use 注册对所有订阅生效的Middleware，只对之后的Subscribe生效。
+// 全局Middleware在WithMiddleware指定的Middleware外层
+func (r *consumerClient) Use(middlewares ...Middleware) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.middlewares = append(r.middlewares, middlewares...)
+}
+
+// WithMiddleware 指定只对当前订阅生效的Middleware
+func WithMiddleware(middlewares ...Middleware) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.middlewares = append(o.middlewares, middlewares...)
+	}
+}
+
+// Recovery handler panic时记录调用栈并返回*PanicError，之后按panic_policy处理
+func Recovery() Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, msg *primitive.MessageExt) (err error) {
+			defer func() {
+				if e := recover(); e != nil {
+					err = recoverPanic(msg, e)
+				}
+			}()
+			return next(ctx, msg)
+		}
+	}
+}
+
+// Logging 记录每条消息的处理结果和耗时，成功为debug级别，失败为error级别
+func Logging() Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, msg *primitive.MessageExt) error {
+			start := time.Now()
+			err := next(ctx, msg)
+			if err != nil {
+				logger.Error(fmt.Sprintf("RocketMQ处理【%s】主题消息%s失败，耗时:%s，重试次数:%d，错误:%s\n", msg.Topic, msg.MsgId, time.Since(start), msg.ReconsumeTimes, err.Error()))
+			} else {
+				logger.Debug(fmt.Sprintf("RocketMQ处理【%s】主题消息%s成功，耗时:%s\n", msg.Topic, msg.MsgId, time.Since(start)))
+			}
+			return err
+		}
+	}
+}
+
+// Timing 每条消息处理完后调用observe，用于上报处理耗时等监控指标
+func Timing(observe func(msg *primitive.MessageExt, elapsed time.Duration, err error)) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, msg *primitive.MessageExt) error {
+			start := time.Now()
+			err := next(ctx, msg)
+			observe(msg, time.Since(start), err)
+			return err
+		}
+	}
+}
+
+// Timeout 为handler的ctx设置超时时间，handler需要自行响应ctx.Done()
+func Timeout(d time.Duration) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, msg *primitive.MessageExt) error {
+			ctx, cancel := context.WithTimeout(ctx, d)
+			defer cancel()
+			return next(ctx, msg)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package consumer
+
+import (
+	"sync"
+	_ "unsafe" // go:linkname
+)
+
+// localOffsetStorePath 广播模式本地offset的存放目录。rocketmq-client-go只在包初始化时读取
+// 环境变量rocketmq.client.localOffsetStoreDir，没有提供Option，OffsetStore接口的方法也未导出，
+// 只能在Start前直接修改。该变量是进程级的。
+// 依赖rocketmq-client-go v2.1.2的内部实现，go.mod中固定了版本：变量改名时这里链接失败，
+// 不再用于本地offset路径时TestLocalOffsetStorePathLinked失败，升级前需要确认。
+// 不配置offset_store_dir时仍可以在进程启动前设置环境变量rocketmq.client.localOffsetStoreDir
+//
+//go:linkname localOffsetStorePath github.com/apache/rocketmq-client-go/v2/consumer._LocalOffsetStorePath
+var localOffsetStorePath string
+
+var (
+	// defaultLocalOffsetStorePath rocketmq-client-go初始化后的默认目录(环境变量或$HOME/.rocketmq_client_go)
+	defaultLocalOffsetStorePath = localOffsetStorePath
+	// offsetStoreMu 串行化修改目录和Start，保证每个消费者Start时读到的是自己的目录
+	offsetStoreMu sync.Mutex
+)
+
+// startWithOffsetStore 将本地offset目录设置为dir后调用start，dir为空时恢复默认目录。
+// rocketmq-client-go只在Start时读取该目录，之后修改不影响已启动的消费者
+func startWithOffsetStore(dir string, start func() error) error {
+	offsetStoreMu.Lock()
+	defer offsetStoreMu.Unlock()
+	if dir == "" {
+		dir = defaultLocalOffsetStorePath
+	}
+	localOffsetStorePath = dir
+	return start()
+}
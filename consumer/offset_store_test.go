@@ -0,0 +1,69 @@
+package consumer
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/apache/rocketmq-client-go/v2/consumer"
+	"github.com/ketianlin/krocketmq/model"
+)
+
+// TestLocalOffsetStorePathLinked rocketmq-client-go创建本地OffsetStore时必须使用链接的变量，
+// 升级rocketmq-client-go后该实现变化时这里失败
+func TestLocalOffsetStorePathLinked(t *testing.T) {
+	dir := t.TempDir()
+	var path string
+	err := startWithOffsetStore(dir, func() error {
+		store := consumer.NewLocalFileOffsetStore("g", "c")
+		path = reflect.ValueOf(store).Elem().FieldByName("path").String()
+		return nil
+	})
+	if err != nil || !strings.HasPrefix(path, dir+string(filepath.Separator)) {
+		t.Fatalf("rocketmq-client-go未使用_LocalOffsetStorePath, offset文件: %q", path)
+	}
+}
+
+func TestStartWithOffsetStore(t *testing.T) {
+	if defaultLocalOffsetStorePath == "" {
+		t.Fatal("应当记录rocketmq-client-go的默认目录")
+	}
+	var seen string
+	start := func() error {
+		seen = localOffsetStorePath
+		return nil
+	}
+	if err := startWithOffsetStore("/data/offsets", start); err != nil || seen != "/data/offsets" {
+		t.Fatalf("Start时应使用配置的目录, 实际%s", seen)
+	}
+	// 之后未配置目录的消费者恢复默认目录
+	if err := startWithOffsetStore("", start); err != nil || seen != defaultLocalOffsetStorePath {
+		t.Fatalf("未配置目录时应恢复默认目录%s, 实际%s", defaultLocalOffsetStorePath, seen)
+	}
+}
+
+func TestPullConsumerOffsetStoreDir(t *testing.T) {
+	for _, c := range []struct {
+		model string
+		want  string
+	}{
+		{MessageModelBroadcasting, "/data/offsets"},
+		// 集群消费offset保存在broker，不使用本地目录
+		{MessageModelClustering, ""},
+	} {
+		conf := newTestConfig()
+		conf.ConsumerConfig.MessageModel = c.model
+		conf.ConsumerConfig.OffsetStoreDir = "/data/offsets"
+		r := &pullConsumerClient{}
+		r.InitConfig(conf, func(im *model.InitCallbackMessage) {
+			if im.InitError != nil {
+				t.Fatal(im.InitError)
+			}
+		})
+		if r.base.offsetStoreDir != c.want {
+			t.Fatalf("%s: 期望本地offset目录%q, 实际%q", c.model, c.want, r.base.offsetStoreDir)
+		}
+		r.Close()
+	}
+}
@@ -0,0 +1,190 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Pause 暂停消费topics，不传topics时暂停全部已订阅的主题。暂停期间消费者不会退出消费组，
+// 已拉取到本地的消息在消费回调中等待Resume，不会交给handler。
+// rocketmq-client-go v2.1.2的Suspend对整个消费者生效，全部已订阅的主题都暂停后才会停止拉取；
+// 只暂停部分主题时，这些主题的本地缓存达到上限后拉取自动停止。
+// 并发消费时消息在回调中等待超过15分钟会被rocketmq-client-go发回broker重新投递
+func (r *consumerClient) Pause(topics ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pause(topics)
+}
+
+// Resume 恢复消费topics，不传topics时恢复全部已暂停的主题
+func (r *consumerClient) Resume(topics ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.resume(topics)
+}
+
+// Paused topic是否已暂停
+func (r *consumerClient) Paused(topic string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.paused[topic]
+	return ok
+}
+
+// PausedTopics 返回已暂停的主题
+func (r *consumerClient) PausedTopics() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	topics := make([]string, 0, len(r.paused))
+	for topic := range r.paused {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+// Suspended 是否已停止从broker拉取消息，全部已订阅的主题都暂停时为true
+func (r *consumerClient) Suspended() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.suspended
+}
+
+// PauseWhenUnhealthy 每隔interval调用check检查下游是否可用，check返回error时暂停topics(不传时为全部已订阅的主题)，
+// 恢复正常后只恢复由检查暂停的主题，手动Pause的主题不受影响。check的ctx在interval后超时。
+// 返回的stop用于停止检查，消费者Close时也会停止
+func (r *consumerClient) PauseWhenUnhealthy(interval time.Duration, check func(ctx context.Context) error, topics ...string) (stop func()) {
+	done := make(chan struct{})
+	r.mu.Lock()
+	r.healthStops = append(r.healthStops, done)
+	r.mu.Unlock()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		var paused []string // 由检查暂停的主题
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), interval)
+			err := check(ctx)
+			cancel()
+			r.mu.Lock()
+			select {
+			case <-done:
+				// 检查期间已停止，不再修改暂停状态
+				r.mu.Unlock()
+				return
+			default:
+			}
+			if err != nil && paused == nil {
+				paused = r.pause(topics)
+				logger.Error(fmt.Sprintf("RocketMQ消费者健康检查失败，暂停消费%v，错误:%s\n", paused, err.Error()))
+			} else if err == nil && paused != nil {
+				logger.Info(fmt.Sprintf("RocketMQ消费者健康检查恢复，恢复消费%v\n", paused))
+				if len(paused) > 0 {
+					r.resume(paused)
+				}
+				paused = nil
+			}
+			r.mu.Unlock()
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			for i, v := range r.healthStops {
+				if v == done {
+					r.healthStops = append(r.healthStops[:i], r.healthStops[i+1:]...)
+					close(done)
+					break
+				}
+			}
+		})
+	}
+}
+
+// pause 调用方需持有r.mu，返回本次新暂停的主题
+func (r *consumerClient) pause(topics []string) []string {
+	if len(topics) == 0 {
+		for topic := range r.subs {
+			topics = append(topics, topic)
+		}
+	}
+	if r.paused == nil {
+		r.paused = make(map[string]chan struct{})
+	}
+	added := make([]string, 0, len(topics))
+	for _, topic := range topics {
+		if _, ok := r.paused[topic]; ok {
+			continue
+		}
+		r.paused[topic] = make(chan struct{})
+		added = append(added, topic)
+	}
+	r.applySuspend()
+	return added
+}
+
+// resume 调用方需持有r.mu
+func (r *consumerClient) resume(topics []string) {
+	if len(topics) == 0 {
+		for topic := range r.paused {
+			topics = append(topics, topic)
+		}
+	}
+	for _, topic := range topics {
+		if ch, ok := r.paused[topic]; ok {
+			close(ch)
+			delete(r.paused, topic)
+		}
+	}
+	r.applySuspend()
+}
+
+// applySuspend 全部已订阅的主题都暂停时停止拉取，否则恢复拉取。调用方需持有r.mu。
+// 未Start的PushConsumer调用Resume会触发rebalance，启动后再同步
+func (r *consumerClient) applySuspend() {
+	if r.conn == nil || !r.started {
+		return
+	}
+	suspend := len(r.subs) > 0
+	for topic := range r.subs {
+		if _, ok := r.paused[topic]; !ok {
+			suspend = false
+			break
+		}
+	}
+	if suspend == r.suspended {
+		return
+	}
+	if suspend {
+		r.conn.Suspend()
+	} else {
+		r.conn.Resume()
+	}
+	r.suspended = suspend
+}
+
+// waitResumed 主题暂停时阻塞消费回调直到Resume，订阅结束时返回false
+func (r *consumerClient) waitResumed(sub *Subscription) bool {
+	r.mu.Lock()
+	ch, ok := r.paused[sub.topic]
+	r.mu.Unlock()
+	if !ok {
+		return true
+	}
+	select {
+	case <-ch:
+		return true
+	case <-sub.done:
+		return false
+	}
+}
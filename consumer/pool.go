@@ -0,0 +1,71 @@
+package consumer
+
+import "sync"
+
+const (
+	// DefaultConcurrency 未配置concurrency时的处理协程数，与rocketmq-client-go的ConsumeGoroutineNums默认值一致
+	DefaultConcurrency = 20
+)
+
+// workerPool 固定数量的协程处理消息，队列满时submit阻塞，从而反压到消费回调。
+// 一个消费者的所有主题共享同一个pool，handler的总并发不超过concurrency，
+// 而每个主题各有concurrency个消费回调协程，订阅N个主题时最多N*concurrency个回调在submit上等待
+type workerPool struct {
+	tasks  chan func()
+	mu     sync.RWMutex
+	closed bool
+	wg     sync.WaitGroup
+}
+
+func newWorkerPool(workers, queueSize int) *workerPool {
+	if workers <= 0 {
+		workers = DefaultConcurrency
+	}
+	if queueSize <= 0 {
+		queueSize = workers
+	}
+	p := &workerPool{tasks: make(chan func(), queueSize)}
+	p.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer p.wg.Done()
+			for task := range p.tasks {
+				task()
+			}
+		}()
+	}
+	return p
+}
+
+// submit 提交任务，队列满时阻塞直到有空位，pool已停止时返回ErrConsumerClosed
+func (p *workerPool) submit(task func()) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return ErrConsumerClosed
+	}
+	p.tasks <- task
+	return nil
+}
+
+// run 提交任务并等待执行完成
+func (p *workerPool) run(task func() error) error {
+	res := make(chan error, 1)
+	if err := p.submit(func() { res <- task() }); err != nil {
+		return err
+	}
+	return <-res
+}
+
+// stop 不再接收新任务，等待队列中的任务执行完
+func (p *workerPool) stop() {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.closed = true
+	close(p.tasks)
+	p.mu.Unlock()
+	p.wg.Wait()
+}
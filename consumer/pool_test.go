@@ -0,0 +1,125 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+)
+
+func TestWorkerPoolBoundedConcurrency(t *testing.T) {
+	p := newWorkerPool(2, 10)
+	defer p.stop()
+	var running, peak int32
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		err := p.submit(func() {
+			defer wg.Done()
+			n := atomic.AddInt32(&running, 1)
+			for {
+				old := atomic.LoadInt32(&peak)
+				if n <= old || atomic.CompareAndSwapInt32(&peak, old, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			atomic.AddInt32(&running, -1)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+	if peak != 2 {
+		t.Fatalf("期望最多2个任务同时执行, 实际%d", peak)
+	}
+}
+
+func TestWorkerPoolSubmitBlocksWhenFull(t *testing.T) {
+	p := newWorkerPool(1, 1)
+	defer p.stop()
+	started, release := make(chan struct{}), make(chan struct{})
+	if err := p.submit(func() { close(started); <-release }); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	// 唯一的协程被占用，第二个任务占满队列
+	if err := p.submit(func() {}); err != nil {
+		t.Fatal(err)
+	}
+	submitted := make(chan error)
+	go func() { submitted <- p.submit(func() {}) }()
+	select {
+	case <-submitted:
+		t.Fatal("队列已满时submit应当阻塞")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	select {
+	case err := <-submitted:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("队列有空位后submit应当返回")
+	}
+}
+
+func TestWorkerPoolStopDrainsThenRejects(t *testing.T) {
+	p := newWorkerPool(1, 5)
+	var done int32
+	for i := 0; i < 5; i++ {
+		if err := p.submit(func() {
+			time.Sleep(5 * time.Millisecond)
+			atomic.AddInt32(&done, 1)
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p.stop()
+	if done != 5 {
+		t.Fatalf("stop应等待队列中的任务执行完, 实际完成%d", done)
+	}
+	if err := p.submit(func() {}); !errors.Is(err, ErrConsumerClosed) {
+		t.Fatalf("stop后submit期望ErrConsumerClosed, 实际%v", err)
+	}
+	if err := p.run(func() error { return nil }); !errors.Is(err, ErrConsumerClosed) {
+		t.Fatalf("stop后run期望ErrConsumerClosed, 实际%v", err)
+	}
+	p.stop()
+}
+
+func TestDispatchAsyncAcksBeforeHandler(t *testing.T) {
+	r := &consumerClient{}
+	p := newWorkerPool(1, 1)
+	defer p.stop()
+	release, handled := make(chan struct{}), make(chan struct{})
+	sub := &Subscription{topic: "T", async: true, handler: func(ctx context.Context, msg *primitive.MessageExt) error {
+		<-release
+		close(handled)
+		return errors.New("处理失败")
+	}}
+	msg := &primitive.MessageExt{MsgId: "m1"}
+	msg.Topic = "T"
+	// async的handler提交到协程池后立即确认，失败只记录日志
+	if err := r.dispatch(context.Background(), p, sub, msg); err != nil {
+		t.Fatalf("async dispatch不应返回handler的错误: %v", err)
+	}
+	close(release)
+	<-handled
+
+	// 顺序消费时async的handler也等待执行结果
+	sub.handler = func(ctx context.Context, msg *primitive.MessageExt) error { return errors.New("处理失败") }
+	if err := (&consumerClient{orderly: true}).dispatch(context.Background(), p, sub, msg); err == nil {
+		t.Fatal("顺序消费时dispatch应返回handler的错误")
+	}
+	sub.async = false
+	if err := r.dispatch(context.Background(), p, sub, msg); err == nil {
+		t.Fatal("同步dispatch应返回handler的错误")
+	}
+}
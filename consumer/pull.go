@@ -0,0 +1,336 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/apache/rocketmq-client-go/v2"
+	"github.com/apache/rocketmq-client-go/v2/admin"
+	"github.com/apache/rocketmq-client-go/v2/consumer"
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+	"github.com/ketianlin/krocketmq/model"
+	"github.com/knadh/koanf"
+)
+
+// ErrNoQueue 主题没有可拉取的队列
+var ErrNoQueue = errors.New("RocketMQ拉取消费者没有可用的队列")
+
+// pullConsumerClient 拉取消费者：由调用方决定何时拉取、拉取多少，并显式提交offset。
+// 与推送消费者共用同一份yaml/model.Config，消费组取ConsumerConfig.Group
+type pullConsumerClient struct {
+	conf    *koanf.Koanf
+	confUrl string
+	conn    rocketmq.PullConsumer
+	// closeError 最近一次Close的错误
+	closeError error
+	admin      admin.Admin
+	base       *consumerClient // 复用配置解析、解密验签和过滤条件
+	config     *model.Config
+
+	mu        sync.Mutex
+	topic     string
+	started   bool
+	fromWhere consumer.ConsumeFromWhere        // 没有提交过offset的队列从哪里开始拉取
+	queues    []*primitive.MessageQueue        // 分配给本实例拉取的队列
+	next      int                              // 下一次拉取的队列下标
+	positions map[primitive.MessageQueue]int64 // 每个队列下一次拉取的offset
+}
+
+var PullConsumerClient = &pullConsumerClient{}
+
+// Init 读取yaml配置创建拉取消费者，配置格式与ConsumerClient相同
+func (r *pullConsumerClient) Init(rocketmqConfigUrl string) {
+	if rocketmqConfigUrl != "" {
+		r.confUrl = rocketmqConfigUrl
+	}
+	if r.confUrl == "" {
+		logger.Error("rocketmq配置Url为空")
+		return
+	}
+	if r.conn == nil {
+		if r.conf == nil {
+			if r.conf = loadConfig(r.confUrl); r.conf == nil {
+				return
+			}
+		}
+		if err := r.newPullConsumer((&consumerClient{conf: r.conf}).readConfig()); err != nil {
+			logger.Error(fmt.Sprintf("RocketMQ创建拉取消费者错误:%s\n", err.Error()))
+		}
+	}
+}
+
+// InitConfig 根据model.Config创建拉取消费者，创建结果通过callback返回
+func (r *pullConsumerClient) InitConfig(conf *model.Config, callback func(im *model.InitCallbackMessage)) {
+	if r.conn != nil {
+		return
+	}
+	cm := new(model.InitCallbackMessage)
+	if err := r.newPullConsumer(conf); err != nil {
+		logger.Error(fmt.Sprintf("RocketMQ创建拉取消费者错误:%s\n", err.Error()))
+		cm.InitError = err
+	}
+	if callback != nil {
+		callback(cm)
+	}
+}
+
+func (r *pullConsumerClient) newPullConsumer(conf *model.Config) error {
+	base := &consumerClient{config: conf}
+	nsResolver, err := base.prepare(conf)
+	if err != nil {
+		return err
+	}
+	messageModel, err := base.getMessageModel(conf.ConsumerConfig.MessageModel)
+	if err != nil {
+		base.stopResolver()
+		return err
+	}
+	fromWhere, err := base.getConsumeFrom(conf.ConsumerConfig.ConsumeFrom)
+	if err == nil && fromWhere == consumer.ConsumeFromTimestamp {
+		// rocketmq-client-go v2.1.2没有按时间查询offset的接口
+		err = fmt.Errorf("RocketMQ拉取消费者不支持consume_from为%s，请用Seek指定起始位置", ConsumeFromTimestamp)
+	}
+	if err != nil {
+		base.stopResolver()
+		return err
+	}
+	c, err := rocketmq.NewPullConsumer(
+		consumer.WithNsResolver(nsResolver),
+		consumer.WithConsumerModel(messageModel),
+		consumer.WithGroupName(conf.ConsumerConfig.Group),
+	)
+	if err != nil {
+		base.stopResolver()
+		return err
+	}
+	a, err := admin.NewAdmin(admin.WithResolver(nsResolver))
+	if err != nil {
+		base.stopResolver()
+		return err
+	}
+	if messageModel == consumer.BroadCasting {
+		base.offsetStoreDir = conf.ConsumerConfig.OffsetStoreDir
+	}
+	r.conn, r.admin, r.base, r.config = c, a, base, conf
+	r.fromWhere = fromWhere
+	r.positions = make(map[primitive.MessageQueue]int64)
+	return nil
+}
+
+// Subscribe 指定拉取的主题，必须在Start之前调用。rocketmq-client-go v2.1.2的拉取消费者只支持一个主题
+func (r *pullConsumerClient) Subscribe(topicName string, opts ...SubscribeOption) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.conn == nil {
+		return ErrNotInitialized
+	}
+	if r.started {
+		return fmt.Errorf("RocketMQ拉取消费者已启动，不能再订阅【%s】", topicName)
+	}
+	selector, err := r.base.selector(topicName, opts)
+	if err != nil {
+		return err
+	}
+	if err = r.conn.Subscribe(topicName, selector); err != nil {
+		return err
+	}
+	r.topic = topicName
+	return nil
+}
+
+// Start 启动拉取消费者。rocketmq-client-go v2.1.2启动后会在后台按rebalance结果持续拉取消息到内部缓存，
+// 该缓存只供Poll读取，Pull不会使用，因此分配给本实例的队列会被拉取两次
+func (r *pullConsumerClient) Start() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.conn == nil {
+		return ErrNotInitialized
+	}
+	if r.started {
+		return nil
+	}
+	if r.topic == "" {
+		return errors.New("RocketMQ拉取消费者启动前需要先Subscribe")
+	}
+	if err := startWithOffsetStore(r.base.offsetStoreDir, r.conn.Start); err != nil {
+		return err
+	}
+	r.started = true
+	return nil
+}
+
+// Queues 返回订阅主题的全部队列
+func (r *pullConsumerClient) Queues(ctx context.Context) ([]*primitive.MessageQueue, error) {
+	if r.admin == nil {
+		return nil, ErrNotInitialized
+	}
+	return r.admin.FetchPublishMessageQueues(ctx, r.topic)
+}
+
+// Assign 指定本实例拉取的队列，未调用时第一次Pull会分配主题的全部队列
+func (r *pullConsumerClient) Assign(queues ...*primitive.MessageQueue) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.queues = queues
+	r.next = 0
+}
+
+// Seek 将queue下一次拉取的位置设置为offset，不会提交offset，未初始化时忽略
+func (r *pullConsumerClient) Seek(queue *primitive.MessageQueue, offset int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.positions != nil {
+		r.positions[*queue] = offset
+	}
+}
+
+// Position queue下一次拉取的offset。未拉取过时读取已提交的offset，没有提交过返回-1
+func (r *pullConsumerClient) Position(queue *primitive.MessageQueue) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.position(queue)
+}
+
+// position 调用方需持有r.mu
+func (r *pullConsumerClient) position(queue *primitive.MessageQueue) (int64, error) {
+	if offset, ok := r.positions[*queue]; ok {
+		return offset, nil
+	}
+	if r.conn == nil {
+		return -1, ErrNotInitialized
+	}
+	return r.conn.CurrentOffset(queue)
+}
+
+// Pull 轮流从分配的队列中拉取最多max条消息，所有队列都没有新消息时返回空切片。
+// 拉取会推进本地位置，但不会提交offset，处理完成后调用Commit。没有提交过offset的队列按consume_from确定起始位置。
+// 某个队列拉取失败时直接返回错误，下一次Pull从它的下一个队列开始，单个队列出错不会阻塞其他队列
+func (r *pullConsumerClient) Pull(ctx context.Context, max int) ([]*primitive.MessageExt, error) {
+	if max <= 0 {
+		return nil, fmt.Errorf("RocketMQ拉取消息数量必须大于0:%d", max)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.started {
+		return nil, ErrNotInitialized
+	}
+	if len(r.queues) == 0 {
+		queues, err := r.admin.FetchPublishMessageQueues(ctx, r.topic)
+		if err != nil {
+			return nil, err
+		}
+		r.queues = queues
+	}
+	if len(r.queues) == 0 {
+		return nil, ErrNoQueue
+	}
+	for i := 0; i < len(r.queues); i++ {
+		// 先推进下标再拉取，无论拉取成功与否下一次都从下一个队列开始
+		queue := r.queues[r.next%len(r.queues)]
+		r.next = (r.next + 1) % len(r.queues)
+		offset, err := r.position(queue)
+		if err != nil {
+			return nil, err
+		}
+		if offset < 0 {
+			if offset, err = r.startOffset(ctx, queue); err != nil {
+				return nil, err
+			}
+		}
+		result, err := r.conn.PullFrom(ctx, queue, offset, max)
+		if err != nil {
+			return nil, err
+		}
+		r.positions[*queue] = result.NextBeginOffset
+		if result.Status != primitive.PullFound {
+			continue
+		}
+		msgs := make([]*primitive.MessageExt, 0, len(result.GetMessageExts()))
+		for _, v := range result.GetMessageExts() {
+			if v, ok := r.base.accept(v); ok {
+				msgs = append(msgs, v)
+			}
+		}
+		if len(msgs) > 0 {
+			return msgs, nil
+		}
+	}
+	return []*primitive.MessageExt{}, nil
+}
+
+// startOffset 没有提交过offset的队列按consume_from确定起始位置。first_offset从0开始，offset过小时broker会返回修正后的位置；
+// last_offset从队列当前的最大offset开始，rocketmq-client-go没有查询最大offset的接口，取拉取一条消息时broker返回的MaxOffset
+func (r *pullConsumerClient) startOffset(ctx context.Context, queue *primitive.MessageQueue) (int64, error) {
+	if r.fromWhere == consumer.ConsumeFromFirstOffset {
+		return 0, nil
+	}
+	result, err := r.conn.PullFrom(ctx, queue, 0, 1)
+	if err != nil {
+		return -1, err
+	}
+	return result.MaxOffset, nil
+}
+
+// Commit 将所有队列当前的拉取位置提交为消费offset。rocketmq-client-go v2.1.2只会持久化rebalance分配给本实例的队列，
+// Assign了其他实例的队列时，这些队列的offset只保存在内存中
+func (r *pullConsumerClient) Commit(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.started {
+		return ErrNotInitialized
+	}
+	for queue, offset := range r.positions {
+		q := queue
+		if err := r.conn.UpdateOffset(&q, offset); err != nil {
+			return err
+		}
+	}
+	return r.conn.PersistOffset(ctx, r.topic)
+}
+
+// CommitOffset 将queue的消费offset提交为offset(下一条要消费的消息)，用于逐条确认
+func (r *pullConsumerClient) CommitOffset(ctx context.Context, queue *primitive.MessageQueue, offset int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.started {
+		return ErrNotInitialized
+	}
+	if err := r.conn.UpdateOffset(queue, offset); err != nil {
+		return err
+	}
+	return r.conn.PersistOffset(ctx, r.topic)
+}
+
+// SetRejectHandler 设置消息无法返回给调用方(签名校验失败、解密失败)时的处理函数，需在InitConfig之后调用
+func (r *pullConsumerClient) SetRejectHandler(handler func(msg *primitive.MessageExt, err error)) {
+	if r.base != nil {
+		r.base.rejectHandler = handler
+	}
+}
+
+func (r *pullConsumerClient) GetCloseError() error {
+	return r.closeError
+}
+
+// Close 关闭拉取消费者，rocketmq-client-go关闭时会持久化内存中的offset
+func (r *pullConsumerClient) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var errs []error
+	if r.conn != nil && r.started {
+		errs = append(errs, r.conn.Shutdown())
+	}
+	if r.admin != nil {
+		errs = append(errs, r.admin.Close())
+	}
+	if r.base != nil {
+		r.base.stopResolver()
+	}
+	r.closeError = errors.Join(errs...)
+	r.conn, r.admin, r.base = nil, nil, nil
+	r.started = false
+	r.topic = ""
+	r.queues, r.next, r.positions = nil, 0, nil
+}
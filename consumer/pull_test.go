@@ -0,0 +1,206 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/apache/rocketmq-client-go/v2"
+	"github.com/apache/rocketmq-client-go/v2/consumer"
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+	"github.com/ketianlin/krocketmq/model"
+)
+
+var errPull = errors.New("拉取失败")
+
+// fakePullConsumer 记录PullFrom、UpdateOffset和PersistOffset调用的rocketmq.PullConsumer
+type fakePullConsumer struct {
+	rocketmq.PullConsumer
+	committed map[primitive.MessageQueue]int64 // 已提交的offset
+	failQueue int                              // PullFrom对该QueueId返回错误，-1表示不出错
+	maxOffset int64                            // PullResult中返回的队列最大offset
+	pulled    []int                            // 依次拉取的QueueId
+	persisted []string
+}
+
+func (f *fakePullConsumer) PullFrom(ctx context.Context, queue *primitive.MessageQueue, offset int64, numbers int) (*primitive.PullResult, error) {
+	f.pulled = append(f.pulled, queue.QueueId)
+	if queue.QueueId == f.failQueue {
+		return nil, errPull
+	}
+	msg := &primitive.MessageExt{MsgId: "m", QueueOffset: offset}
+	msg.Topic = queue.Topic
+	result := &primitive.PullResult{NextBeginOffset: offset + 1, MaxOffset: f.maxOffset, Status: primitive.PullFound}
+	result.SetMessageExts([]*primitive.MessageExt{msg})
+	return result, nil
+}
+
+func (f *fakePullConsumer) UpdateOffset(queue *primitive.MessageQueue, offset int64) error {
+	f.committed[*queue] = offset
+	return nil
+}
+
+func (f *fakePullConsumer) PersistOffset(ctx context.Context, topic string) error {
+	f.persisted = append(f.persisted, topic)
+	return nil
+}
+
+func (f *fakePullConsumer) CurrentOffset(queue *primitive.MessageQueue) (int64, error) {
+	if offset, ok := f.committed[*queue]; ok {
+		return offset, nil
+	}
+	return -1, nil
+}
+
+// newTestPullClient 创建已启动的拉取消费者，分配T主题的两个队列，没有提交过offset的队列从0开始拉取
+func newTestPullClient() (*pullConsumerClient, *fakePullConsumer, []*primitive.MessageQueue) {
+	fake := &fakePullConsumer{committed: make(map[primitive.MessageQueue]int64), failQueue: -1}
+	queues := []*primitive.MessageQueue{{Topic: "T", BrokerName: "b", QueueId: 0}, {Topic: "T", BrokerName: "b", QueueId: 1}}
+	r := &pullConsumerClient{
+		conn:      fake,
+		base:      &consumerClient{},
+		topic:     "T",
+		started:   true,
+		fromWhere: consumer.ConsumeFromFirstOffset,
+		positions: make(map[primitive.MessageQueue]int64),
+	}
+	r.Assign(queues...)
+	return r, fake, queues
+}
+
+func TestPullRejectsNonPositiveMax(t *testing.T) {
+	r, fake, _ := newTestPullClient()
+	for _, max := range []int{0, -1} {
+		if _, err := r.Pull(context.Background(), max); err == nil {
+			t.Fatalf("max=%d应当返回错误", max)
+		}
+	}
+	if len(fake.pulled) != 0 {
+		t.Fatalf("max不合法时不应拉取: %v", fake.pulled)
+	}
+}
+
+func TestPullSeekAndPosition(t *testing.T) {
+	r, fake, queues := newTestPullClient()
+	fake.committed[*queues[1]] = 7
+	if offset, err := r.Position(queues[0]); err != nil || offset != -1 {
+		t.Fatalf("未提交过的队列期望-1, 实际: %d %v", offset, err)
+	}
+	if offset, err := r.Position(queues[1]); err != nil || offset != 7 {
+		t.Fatalf("未拉取过时应读取已提交的offset, 实际: %d %v", offset, err)
+	}
+	r.Seek(queues[0], 5)
+	if offset, err := r.Position(queues[0]); err != nil || offset != 5 {
+		t.Fatalf("Seek后位置错误: %d %v", offset, err)
+	}
+	if _, ok := fake.committed[*queues[0]]; ok {
+		t.Fatal("Seek不应提交offset")
+	}
+	msgs, err := r.Pull(context.Background(), 1)
+	if err != nil || len(msgs) != 1 || msgs[0].QueueOffset != 5 {
+		t.Fatalf("应当从Seek的位置拉取, 实际: %v %v", msgs, err)
+	}
+	if offset, _ := r.Position(queues[0]); offset != 6 {
+		t.Fatalf("拉取后位置应当推进, 实际: %d", offset)
+	}
+}
+
+func TestPullRoundRobinOnFailure(t *testing.T) {
+	r, fake, _ := newTestPullClient()
+	fake.failQueue = 0
+	if _, err := r.Pull(context.Background(), 1); !errors.Is(err, errPull) {
+		t.Fatalf("期望拉取错误, 实际: %v", err)
+	}
+	msgs, err := r.Pull(context.Background(), 1)
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("失败后应当继续拉取下一个队列, 实际: %v %v", msgs, err)
+	}
+	fake.failQueue = -1
+	if _, err = r.Pull(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(fake.pulled); got != "[0 1 0]" {
+		t.Fatalf("拉取顺序错误: %v", fake.pulled)
+	}
+}
+
+func TestPullCommit(t *testing.T) {
+	r, fake, queues := newTestPullClient()
+	for i := 0; i < 3; i++ {
+		if _, err := r.Pull(context.Background(), 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.Commit(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if fake.committed[*queues[0]] != 2 || fake.committed[*queues[1]] != 1 {
+		t.Fatalf("Commit应当提交当前拉取位置, 实际: %v", fake.committed)
+	}
+	if err := r.CommitOffset(context.Background(), queues[1], 9); err != nil {
+		t.Fatal(err)
+	}
+	if fake.committed[*queues[1]] != 9 {
+		t.Fatalf("CommitOffset提交错误: %v", fake.committed)
+	}
+	if len(fake.persisted) != 2 || fake.persisted[0] != "T" {
+		t.Fatalf("每次提交都应当持久化offset: %v", fake.persisted)
+	}
+	r.started = false
+	if err := r.Commit(context.Background()); !errors.Is(err, ErrNotInitialized) {
+		t.Fatalf("未启动时期望ErrNotInitialized, 实际: %v", err)
+	}
+}
+
+func TestPullStartOffset(t *testing.T) {
+	r, fake, queues := newTestPullClient()
+	r.fromWhere = consumer.ConsumeFromLastOffset
+	fake.maxOffset = 10
+	fake.committed[*queues[1]] = 3
+	msgs, err := r.Pull(context.Background(), 1)
+	if err != nil || len(msgs) != 1 || msgs[0].QueueOffset != 10 {
+		t.Fatalf("last_offset应当从队列最大offset开始, 实际: %v %v", msgs, err)
+	}
+	// 已提交过offset的队列不受consume_from影响
+	msgs, err = r.Pull(context.Background(), 1)
+	if err != nil || len(msgs) != 1 || msgs[0].QueueOffset != 3 {
+		t.Fatalf("应当从已提交的offset开始, 实际: %v %v", msgs, err)
+	}
+	// 第一次拉取先取一条消息获得MaxOffset
+	if got := fmt.Sprint(fake.pulled); got != "[0 0 1]" {
+		t.Fatalf("拉取顺序错误: %v", fake.pulled)
+	}
+}
+
+func TestPullConsumeFromConfig(t *testing.T) {
+	for _, c := range []struct {
+		from string
+		want consumer.ConsumeFromWhere
+		fail bool
+	}{
+		{"", consumer.ConsumeFromLastOffset, false},
+		{ConsumeFromFirstOffset, consumer.ConsumeFromFirstOffset, false},
+		// 没有按时间查询offset的接口
+		{ConsumeFromTimestamp, 0, true},
+	} {
+		conf := newTestConfig()
+		conf.ConsumerConfig.ConsumeFrom = c.from
+		conf.ConsumerConfig.ConsumeTimestamp = "-1h"
+		r := &pullConsumerClient{}
+		var initErr error
+		r.InitConfig(conf, func(im *model.InitCallbackMessage) {
+			initErr = im.InitError
+		})
+		if c.fail {
+			if initErr == nil || r.conn != nil {
+				t.Fatalf("%s: 拉取消费者应当拒绝该配置", c.from)
+			}
+			continue
+		}
+		if initErr != nil || r.fromWhere != c.want {
+			t.Fatalf("%q: 期望%v, 实际%v %v", c.from, c.want, r.fromWhere, initErr)
+		}
+		r.Close()
+	}
+}
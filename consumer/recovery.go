@@ -0,0 +1,81 @@
+package consumer
+
+import (
+	"errors"
+	"expvar"
+	"fmt"
+	"runtime/debug"
+	"strings"
+	"sync/atomic"
+
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+)
+
+const (
+	// PanicPolicyRetry handler panic后消息稍后重新投递(默认)
+	PanicPolicyRetry = "retry"
+	// PanicPolicyAck handler panic后直接确认消息，消息被丢弃
+	PanicPolicyAck = "ack"
+	// PanicPolicyDeadLetter handler panic后立即交给DeadLetterHandler，未设置或处理失败时重新投递
+	PanicPolicyDeadLetter = "dead_letter"
+)
+
+// panicsVar 按主题统计的handler panic次数，通过expvar暴露为krocketmq_consumer_panics
+var panicsVar = expvar.NewMap("krocketmq_consumer_panics")
+
+// PanicError handler panic时返回的错误
+type PanicError struct {
+	Value interface{} // recover得到的值
+	Stack []byte      // panic时的调用栈
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("RocketMQ消息处理panic:%v", e.Value)
+}
+
+// PanicCount 消费者启动以来handler panic的总次数，包括Recovery Middleware恢复的panic
+func (r *consumerClient) PanicCount() int64 {
+	return atomic.LoadInt64(&r.panics)
+}
+
+// countPanic handler返回*PanicError时计数
+func (r *consumerClient) countPanic(err error) {
+	var pe *PanicError
+	if errors.As(err, &pe) {
+		atomic.AddInt64(&r.panics, 1)
+	}
+}
+
+// getPanicPolicy 解析panic处理策略，默认重试
+func (r *consumerClient) getPanicPolicy(policy string) (string, error) {
+	switch p := strings.ToLower(policy); p {
+	case "":
+		return PanicPolicyRetry, nil
+	case PanicPolicyRetry, PanicPolicyAck, PanicPolicyDeadLetter:
+		return p, nil
+	}
+	return "", fmt.Errorf("RocketMQ panic处理策略%s错误，只支持%s、%s和%s", policy, PanicPolicyRetry, PanicPolicyAck, PanicPolicyDeadLetter)
+}
+
+// recoverPanic 记录handler的panic：打印调用栈并按主题计入expvar，消费者的计数由countPanic完成
+func recoverPanic(msg *primitive.MessageExt, e interface{}) *PanicError {
+	pe := &PanicError{Value: e, Stack: debug.Stack()}
+	panicsVar.Add(msg.Topic, 1)
+	logger.Error(fmt.Sprintf("RocketMQ处理【%s】主题消息%s panic:%v\n%s", msg.Topic, msg.MsgId, e, pe.Stack))
+	return pe
+}
+
+// failed handler返回error或panic后的处理，返回true表示消息可以确认
+func (r *consumerClient) failed(msg *primitive.MessageExt, err error) bool {
+	var pe *PanicError
+	if errors.As(err, &pe) {
+		switch r.panicPolicy {
+		case PanicPolicyAck:
+			return true
+		case PanicPolicyDeadLetter:
+			// 已经调用过DeadLetterHandler，处理失败时直接重新投递，不再按最后一次重试调用第二次
+			return r.callDeadLetter(msg, err)
+		}
+	}
+	return r.deadLetter(msg, err)
+}
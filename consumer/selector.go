@@ -0,0 +1,66 @@
+package consumer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/apache/rocketmq-client-go/v2/consumer"
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+)
+
+// SubscribeOption 订阅选项
+type SubscribeOption func(o *subscribeOptions)
+
+type subscribeOptions struct {
+	tag                string
+	sql                string
+	custom             bool // 调用方显式指定了过滤条件，不再使用配置
+	codec              Codec
+	decodeErrorHandler func(msg *primitive.MessageExt, err *DecodeError)
+	middlewares        []Middleware
+	batchSize          int
+}
+
+func newSubscribeOptions(opts []SubscribeOption) *subscribeOptions {
+	o := new(subscribeOptions)
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithTag 按tag表达式过滤，如 "TagA || TagB"，"*"或空表示全部
+func WithTag(expression string) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.tag = expression
+		o.custom = true
+	}
+}
+
+// WithSQL 按SQL92表达式过滤消息属性，需要broker开启enablePropertyFilter
+func WithSQL(expression string) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.sql = expression
+		o.custom = true
+	}
+}
+
+// selector 计算topicName的过滤条件：调用方的选项优先，其次是配置中的subscriptions
+func (r *consumerClient) selector(topicName string, opts []SubscribeOption) (consumer.MessageSelector, error) {
+	o := newSubscribeOptions(opts)
+	if !o.custom && r.config != nil {
+		if c, ok := r.config.ConsumerConfig.Subscriptions[topicName]; ok {
+			o.tag, o.sql = c.Tag, c.Sql
+		}
+	}
+	tag, sql := strings.TrimSpace(o.tag), strings.TrimSpace(o.sql)
+	switch {
+	case tag != "" && sql != "":
+		return consumer.MessageSelector{}, fmt.Errorf("RocketMQ订阅【%s】的tag和sql过滤条件只能配置一个", topicName)
+	case sql != "":
+		return consumer.MessageSelector{Type: consumer.SQL92, Expression: sql}, nil
+	case tag != "":
+		return consumer.MessageSelector{Type: consumer.TAG, Expression: tag}, nil
+	}
+	return consumer.MessageSelector{}, nil
+}
@@ -0,0 +1,318 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/apache/rocketmq-client-go/v2/consumer"
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+)
+
+var (
+	// ErrNotInitialized 消费者未初始化(Init/InitConfig未调用或已Close)
+	ErrNotInitialized = errors.New("RocketMQ消费者未初始化")
+	// ErrConsumerClosed 消费者已关闭，订阅随之结束
+	ErrConsumerClosed = errors.New("RocketMQ消费者已关闭")
+)
+
+// Handler 同步处理一条消息，返回error(或panic)时消息稍后重新投递：
+// 并发消费返回ConsumeRetryLater，顺序消费返回SuspendCurrentQueueAMoment
+type Handler func(ctx context.Context, msg *primitive.MessageExt) error
+
+// Subscription 一个主题的订阅句柄
+type Subscription struct {
+	topic     string
+	selector  consumer.MessageSelector
+	handler   Handler
+	async     bool         // handler提交到协程池后立即确认消息，不等待处理结果
+	batch     BatchHandler // 批量处理函数，见SubscribeBatch
+	batchSize int
+	acked     *ackedSet
+	client    *consumerClient
+	done      chan struct{}
+	once      sync.Once
+	err       error
+}
+
+// Topic 订阅的主题
+func (s *Subscription) Topic() string {
+	return s.topic
+}
+
+// Selector 订阅使用的服务端过滤条件
+func (s *Subscription) Selector() consumer.MessageSelector {
+	return s.selector
+}
+
+// Done 订阅结束(Unsubscribe、消费者关闭或启动失败)时关闭
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err 订阅结束的原因，订阅未结束或主动Unsubscribe时返回nil
+func (s *Subscription) Err() error {
+	select {
+	case <-s.done:
+		return s.err
+	default:
+		return nil
+	}
+}
+
+// Unsubscribe 取消订阅。取消后已拉取到本地但未处理的消息返回ConsumeRetryLater，不会再交给handler
+func (s *Subscription) Unsubscribe() error {
+	r := s.client
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.subs[s.topic] != s {
+		return nil
+	}
+	delete(r.subs, s.topic)
+	var err error
+	if r.conn != nil {
+		err = r.conn.Unsubscribe(s.topic)
+	}
+	s.finish(nil)
+	r.applySuspend()
+	return err
+}
+
+func (s *Subscription) finish(err error) {
+	s.once.Do(func() {
+		s.err = err
+		close(s.done)
+	})
+}
+
+func (s *Subscription) closed() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Subscribe 注册主题的处理函数并返回订阅句柄。可以先注册多个主题再调用一次Start统一启动，
+// 也可以在Start之后追加主题，追加的主题在下一次负载均衡后开始消费。
+// opts未指定过滤条件时使用配置中subscriptions下该主题的tag/sql。
+// 并发消费时listener提交到协程池后立即确认消息，顺序消费时等待listener执行完；需要失败重试时使用SubscribeHandler
+func (r *consumerClient) Subscribe(topicName string, listener func(msg *primitive.MessageExt), opts ...SubscribeOption) (*Subscription, error) {
+	return r.subscribe(topicName, func(ctx context.Context, msg *primitive.MessageExt) error {
+		listener(msg)
+		return nil
+	}, true, opts)
+}
+
+// SubscribeHandler 与Subscribe相同，但handler在消费回调中同步执行，
+// handler返回error时消息会重新投递，保证至少一次消费
+func (r *consumerClient) SubscribeHandler(topicName string, handler Handler, opts ...SubscribeOption) (*Subscription, error) {
+	return r.subscribe(topicName, handler, false, opts)
+}
+
+func (r *consumerClient) subscribe(topicName string, handler Handler, async bool, opts []SubscribeOption) (*Subscription, error) {
+	return r.register(&Subscription{topic: topicName, handler: handler, async: async}, opts)
+}
+
+// register 补全订阅句柄并向PushConsumer注册，sub需要填好topic和handler/batch
+func (r *consumerClient) register(sub *Subscription, opts []SubscribeOption) (*Subscription, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.conn == nil {
+		return nil, ErrNotInitialized
+	}
+	if _, ok := r.subs[sub.topic]; ok {
+		return nil, fmt.Errorf("RocketMQ主题【%s】已订阅", sub.topic)
+	}
+	selector, err := r.selector(sub.topic, opts)
+	if err != nil {
+		return nil, err
+	}
+	if sub.handler != nil {
+		// 全局Middleware在外层，订阅自己的Middleware在内层
+		sub.handler = Chain(newSubscribeOptions(opts).middlewares...)(sub.handler)
+		sub.handler = Chain(r.middlewares...)(sub.handler)
+	}
+	sub.selector = selector
+	sub.client = r
+	sub.done = make(chan struct{})
+	if err = r.conn.Subscribe(sub.topic, selector, r.consumeFunc(sub)); err != nil {
+		return nil, err
+	}
+	if r.subs == nil {
+		r.subs = make(map[string]*Subscription)
+	}
+	r.subs[sub.topic] = sub
+	// 新订阅的主题未暂停时需要恢复拉取
+	r.applySuspend()
+	return sub, nil
+}
+
+// Listen 订阅主题并启动消费者，不会阻塞
+func (r *consumerClient) Listen(topicName string, listener func(msg *primitive.MessageExt), opts ...SubscribeOption) (*Subscription, error) {
+	sub, err := r.Subscribe(topicName, listener, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err = r.Start(); err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+// ListenHandler 订阅主题并启动消费者，不会阻塞，handler语义同SubscribeHandler
+func (r *consumerClient) ListenHandler(topicName string, handler Handler, opts ...SubscribeOption) (*Subscription, error) {
+	sub, err := r.SubscribeHandler(topicName, handler, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err = r.Start(); err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+// Start 启动消费者，重复调用只会启动一次。启动失败时已注册的订阅都会结束
+func (r *consumerClient) Start() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.conn == nil {
+		return ErrNotInitialized
+	}
+	if r.started {
+		return nil
+	}
+	if err := startWithOffsetStore(r.offsetStoreDir, r.conn.Start); err != nil {
+		r.finishAll(err)
+		return err
+	}
+	r.started = true
+	r.applySuspend()
+	return nil
+}
+
+// Run 启动消费者并阻塞到ctx结束，随后关闭消费者
+func (r *consumerClient) Run(ctx context.Context) error {
+	if err := r.Start(); err != nil {
+		return err
+	}
+	<-ctx.Done()
+	r.Close()
+	return r.GetCloseError()
+}
+
+// Topics 返回已订阅的主题
+func (r *consumerClient) Topics() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	topics := make([]string, 0, len(r.subs))
+	for topic := range r.subs {
+		topics = append(topics, topic)
+	}
+	return topics
+}
+
+// finishAll 结束所有订阅，调用方需持有r.mu
+func (r *consumerClient) finishAll(err error) {
+	for topic, sub := range r.subs {
+		sub.finish(err)
+		delete(r.subs, topic)
+	}
+}
+
+func (r *consumerClient) consumeFunc(sub *Subscription) func(context.Context, ...*primitive.MessageExt) (consumer.ConsumeResult, error) {
+	pool := r.pool
+	return func(ctx context.Context, msg ...*primitive.MessageExt) (consumer.ConsumeResult, error) {
+		if sub.closed() || !r.waitResumed(sub) {
+			return r.retry(ctx), nil
+		}
+		if sub.batch != nil {
+			return r.consumeBatch(ctx, pool, sub, msg), nil
+		}
+		for _, v := range msg {
+			v, ok := r.accept(v)
+			if !ok {
+				continue
+			}
+			if err := r.dispatch(ctx, pool, sub, v); err != nil {
+				if r.failed(v, err) {
+					continue
+				}
+				// 批量中任意一条失败整批重新投递，之前处理成功的消息会被再次消费
+				logger.Error(fmt.Sprintf("RocketMQ消费【%s】主题消息%s失败，稍后重试，错误:%s\n", v.Topic, v.MsgId, err.Error()))
+				return r.retry(ctx), nil
+			}
+		}
+		return consumer.ConsumeSuccess, nil
+	}
+}
+
+// dispatch 在协程池中执行handler。协程池队列满时阻塞消费回调，rocketmq-client-go随之停止拉取新消息。
+// 顺序消费时同一队列的消息必须逐条处理完，async的handler也会等待执行结果
+func (r *consumerClient) dispatch(ctx context.Context, pool *workerPool, sub *Subscription, msg *primitive.MessageExt) error {
+	if pool == nil {
+		return r.handle(ctx, sub.handler, msg)
+	}
+	if sub.async && !r.orderly {
+		return pool.submit(func() {
+			// 消息已经确认，失败时只能记录日志或交给DeadLetterHandler
+			if err := r.handle(ctx, sub.handler, msg); err != nil && !r.failed(msg, err) {
+				logger.Error(fmt.Sprintf("RocketMQ处理【%s】主题消息%s失败，错误:%s\n", msg.Topic, msg.MsgId, err.Error()))
+			}
+		})
+	}
+	return pool.run(func() error {
+		return r.handle(ctx, sub.handler, msg)
+	})
+}
+
+// handle 执行handler，handler panic时记录调用栈并转换为*PanicError
+func (r *consumerClient) handle(ctx context.Context, handler Handler, msg *primitive.MessageExt) (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = recoverPanic(msg, e)
+		}
+		r.countPanic(err)
+	}()
+	return handler(ctx, msg)
+}
+
+// retry 消息需要重新投递时的消费结果。并发消费由broker稍后重新投递；
+// 顺序消费挂起当前队列suspendTime后重试同一条消息，队列中后面的消息不会先被处理
+func (r *consumerClient) retry(ctx context.Context) consumer.ConsumeResult {
+	if !r.orderly {
+		return consumer.ConsumeRetryLater
+	}
+	if oc, ok := primitive.GetOrderlyCtx(ctx); ok {
+		oc.SuspendCurrentQueueTimeMillis = int(r.suspendTime / time.Millisecond)
+	}
+	return consumer.SuspendCurrentQueueAMoment
+}
+
+// listen MessageListener系列方法的公共逻辑：订阅、启动，然后一直阻塞
+func (r *consumerClient) listen(topicName string, handler Handler, async bool, callbacks ...func(err error)) {
+	_, err := r.subscribe(topicName, handler, async, nil)
+	if err != nil {
+		logger.Error(fmt.Sprintf("RocketMQ消费者订阅【%s】主题失败，错误:%s\n", topicName, err.Error()))
+		if len(callbacks) > 0 {
+			callbacks[0](err)
+		}
+	}
+	forever := make(chan bool)
+	err = r.Start()
+	if err != nil && !errors.Is(err, ErrNotInitialized) {
+		errAll := err
+		err2 := r.conn.Shutdown()
+		if err2 != nil {
+			errAll = errors.Join(errAll, err2)
+		}
+		logger.Error(fmt.Sprintf("RocketMQ消费者启动监听【%s】主题失败:%s\n", topicName, errAll.Error()))
+		if len(callbacks) > 0 {
+			callbacks[0](err)
+		}
+	}
+	<-forever
+}
@@ -0,0 +1,119 @@
+package consumer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+)
+
+// Codec 将消息体解码为handler需要的类型
+type Codec interface {
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// JSONCodec 使用encoding/json解码
+type JSONCodec struct{}
+
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// DefaultCodec 未通过WithCodec指定时使用的解码器
+var DefaultCodec Codec = JSONCodec{}
+
+// DecodeError 消息体解码失败
+type DecodeError struct {
+	Topic string
+	MsgId string
+	Err   error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("RocketMQ主题【%s】消息%s解码失败:%s", e.Topic, e.MsgId, e.Err.Error())
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// Meta 除消息体外的消息信息
+type Meta struct {
+	Topic          string
+	Tags           string
+	Keys           string
+	MsgId          string
+	QueueId        int
+	QueueOffset    int64
+	ReconsumeTimes int32
+	BornTime       time.Time
+	Properties     map[string]string
+	Message        *primitive.MessageExt // 原始消息
+}
+
+func newMeta(msg *primitive.MessageExt) Meta {
+	m := Meta{
+		Topic:          msg.Topic,
+		Tags:           msg.GetTags(),
+		Keys:           msg.GetKeys(),
+		MsgId:          msg.MsgId,
+		QueueOffset:    msg.QueueOffset,
+		ReconsumeTimes: msg.ReconsumeTimes,
+		BornTime:       time.UnixMilli(msg.BornTimestamp),
+		Properties:     msg.GetProperties(),
+		Message:        msg,
+	}
+	if msg.Queue != nil {
+		m.QueueId = msg.Queue.QueueId
+	}
+	return m
+}
+
+// WithCodec 指定Typed/Subscribe[T]/Listen[T]解码消息体使用的Codec
+func WithCodec(codec Codec) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.codec = codec
+	}
+}
+
+// WithDecodeErrorHandler 指定消息体解码失败时的处理函数。解码失败的消息不会交给handler，
+// 重试也无法解码成功，处理后消息直接确认；未指定时只记录日志
+func WithDecodeErrorHandler(handler func(msg *primitive.MessageExt, err *DecodeError)) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.decodeErrorHandler = handler
+	}
+}
+
+// Typed 将按类型处理消息的handler转换为Handler，消息体先用Codec解码为T
+func Typed[T any](handler func(ctx context.Context, v T, meta Meta) error, opts ...SubscribeOption) Handler {
+	o := newSubscribeOptions(opts)
+	codec := o.codec
+	if codec == nil {
+		codec = DefaultCodec
+	}
+	return func(ctx context.Context, msg *primitive.MessageExt) error {
+		var v T
+		if err := codec.Unmarshal(msg.Body, &v); err != nil {
+			de := &DecodeError{Topic: msg.Topic, MsgId: msg.MsgId, Err: err}
+			if o.decodeErrorHandler != nil {
+				o.decodeErrorHandler(msg, de)
+			} else {
+				logger.Error(de.Error())
+			}
+			return nil
+		}
+		return handler(ctx, v, newMeta(msg))
+	}
+}
+
+// Subscribe 在ConsumerClient上订阅主题，消息体解码为T后交给handler，handler语义同SubscribeHandler
+func Subscribe[T any](topicName string, handler func(ctx context.Context, v T, meta Meta) error, opts ...SubscribeOption) (*Subscription, error) {
+	return ConsumerClient.SubscribeHandler(topicName, Typed(handler, opts...), opts...)
+}
+
+// Listen 与Subscribe[T]相同，订阅后启动消费者，不会阻塞
+func Listen[T any](topicName string, handler func(ctx context.Context, v T, meta Meta) error, opts ...SubscribeOption) (*Subscription, error) {
+	return ConsumerClient.ListenHandler(topicName, Typed(handler, opts...), opts...)
+}
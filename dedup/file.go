@@ -0,0 +1,88 @@
+package dedup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"git.mills.io/prologic/bitcask"
+	"github.com/ketianlin/krocketmq/consumer"
+)
+
+// maxKeySize bitcask默认key最长64字节，主题名加消息ID容易超过
+const maxKeySize = 1024
+
+var (
+	valueInProgress = []byte("processing")
+	valueDone       = []byte("done")
+)
+
+// FileStore 基于bitcask的DedupStore，状态保存在本地目录，重启后仍然有效。
+// bitcask同一目录只允许一个进程打开，适合每个实例使用自己的目录
+type FileStore struct {
+	mu sync.Mutex // 保证Acquire的检查和写入是原子的
+	db *bitcask.Bitcask
+}
+
+// NewFileStore 打开(或创建)dir下的bitcask数据库
+func NewFileStore(dir string) (*FileStore, error) {
+	db, err := bitcask.Open(dir, bitcask.WithMaxKeySize(maxKeySize))
+	if err != nil {
+		return nil, fmt.Errorf("RocketMQ去重存储%s打开失败:%w", dir, err)
+	}
+	return &FileStore{db: db}, nil
+}
+
+func (s *FileStore) Acquire(ctx context.Context, key string, ttl time.Duration) (consumer.DedupState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	value, err := s.db.Get([]byte(key))
+	switch {
+	case err == nil:
+		if string(value) == string(valueDone) {
+			return consumer.DedupDone, nil
+		}
+		return consumer.DedupInProgress, nil
+	case !errors.Is(err, bitcask.ErrKeyNotFound) && !errors.Is(err, bitcask.ErrKeyExpired):
+		return consumer.DedupInProgress, err
+	}
+	if err = s.db.PutWithTTL([]byte(key), valueInProgress, ttl); err != nil {
+		return consumer.DedupInProgress, err
+	}
+	return consumer.DedupAcquired, nil
+}
+
+func (s *FileStore) Done(ctx context.Context, key string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.db.PutWithTTL([]byte(key), valueDone, ttl)
+}
+
+func (s *FileStore) Release(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	value, err := s.db.Get([]byte(key))
+	if err != nil || string(value) != string(valueInProgress) {
+		return nil
+	}
+	return s.db.Delete([]byte(key))
+}
+
+// Sweep 删除已过期的key并回收磁盘空间，可以定期调用
+func (s *FileStore) Sweep() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.db.RunGC(); err != nil {
+		return err
+	}
+	return s.db.Merge()
+}
+
+// Close 关闭数据库
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.db.Close()
+}
@@ -0,0 +1,78 @@
+// Package dedup 提供consumer.DedupStore的内存、文件(bitcask)和SQL实现
+package dedup
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ketianlin/krocketmq/consumer"
+)
+
+// sweepInterval 内存实现清理过期key的间隔
+const sweepInterval = time.Minute
+
+type memoryEntry struct {
+	state  consumer.DedupState
+	expire time.Time
+}
+
+// MemoryStore 进程内的DedupStore，只能识别本实例收到的重复消息，重启后状态丢失
+type MemoryStore struct {
+	mu        sync.Mutex
+	entries   map[string]memoryEntry
+	lastSweep time.Time
+}
+
+// NewMemoryStore 创建内存DedupStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]memoryEntry), lastSweep: time.Now()}
+}
+
+func (s *MemoryStore) Acquire(ctx context.Context, key string, ttl time.Duration) (consumer.DedupState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.sweep(now)
+	if e, ok := s.entries[key]; ok && now.Before(e.expire) {
+		return e.state, nil
+	}
+	s.entries[key] = memoryEntry{state: consumer.DedupInProgress, expire: now.Add(ttl)}
+	return consumer.DedupAcquired, nil
+}
+
+func (s *MemoryStore) Done(ctx context.Context, key string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[key] = memoryEntry{state: consumer.DedupDone, expire: time.Now().Add(ttl)}
+	return nil
+}
+
+func (s *MemoryStore) Release(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[key]; ok && e.state == consumer.DedupInProgress {
+		delete(s.entries, key)
+	}
+	return nil
+}
+
+// Len 当前保存的key数量(包含尚未清理的过期key)
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.entries)
+}
+
+// sweep 定期删除过期key，调用方需持有s.mu
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return
+	}
+	for key, e := range s.entries {
+		if !now.Before(e.expire) {
+			delete(s.entries, key)
+		}
+	}
+	s.lastSweep = now
+}
@@ -0,0 +1,112 @@
+package dedup
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/ketianlin/krocketmq/consumer"
+)
+
+const (
+	sqlStateInProgress = 1
+	sqlStateDone       = 2
+)
+
+// SQLStore 基于database/sql的DedupStore，多个实例共享同一张表即可跨实例去重。表结构：
+//
+//	CREATE TABLE krocketmq_dedup (
+//	    dedup_key VARCHAR(255) NOT NULL PRIMARY KEY,
+//	    state     INT          NOT NULL,
+//	    expire_at BIGINT       NOT NULL
+//	)
+type SQLStore struct {
+	db          *sql.DB
+	table       string
+	placeholder func(n int) string
+
+	deleteExpired string
+	insert        string
+	selectState   string
+	markDone      string
+	release       string
+	sweep         string
+}
+
+// SQLOption SQLStore选项
+type SQLOption func(s *SQLStore)
+
+// WithDollarPlaceholder 使用$1、$2形式的参数占位符(PostgreSQL)，默认为?(MySQL、SQLite)
+func WithDollarPlaceholder() SQLOption {
+	return func(s *SQLStore) {
+		s.placeholder = func(n int) string {
+			return "$" + strconv.Itoa(n)
+		}
+	}
+}
+
+// NewSQLStore 使用db中的table保存去重状态，table为空时使用krocketmq_dedup
+func NewSQLStore(db *sql.DB, table string, opts ...SQLOption) *SQLStore {
+	if table == "" {
+		table = "krocketmq_dedup"
+	}
+	s := &SQLStore{db: db, table: table, placeholder: func(int) string { return "?" }}
+	for _, opt := range opts {
+		opt(s)
+	}
+	p := s.placeholder
+	s.deleteExpired = fmt.Sprintf("DELETE FROM %s WHERE dedup_key = %s AND expire_at <= %s", table, p(1), p(2))
+	s.insert = fmt.Sprintf("INSERT INTO %s (dedup_key, state, expire_at) VALUES (%s, %s, %s)", table, p(1), p(2), p(3))
+	s.selectState = fmt.Sprintf("SELECT state FROM %s WHERE dedup_key = %s", table, p(1))
+	s.markDone = fmt.Sprintf("UPDATE %s SET state = %s, expire_at = %s WHERE dedup_key = %s", table, p(1), p(2), p(3))
+	s.release = fmt.Sprintf("DELETE FROM %s WHERE dedup_key = %s AND state = %s", table, p(1), p(2))
+	s.sweep = fmt.Sprintf("DELETE FROM %s WHERE expire_at <= %s", table, p(1))
+	return s
+}
+
+// CreateTable 表不存在时创建
+func (s *SQLStore) CreateTable(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS "+s.table+
+		" (dedup_key VARCHAR(255) NOT NULL PRIMARY KEY, state INT NOT NULL, expire_at BIGINT NOT NULL)")
+	return err
+}
+
+func (s *SQLStore) Acquire(ctx context.Context, key string, ttl time.Duration) (consumer.DedupState, error) {
+	now := time.Now()
+	// 先删除已过期的记录，再依靠主键冲突保证只有一个调用方插入成功
+	if _, err := s.db.ExecContext(ctx, s.deleteExpired, key, now.UnixMilli()); err != nil {
+		return consumer.DedupInProgress, err
+	}
+	_, insertErr := s.db.ExecContext(ctx, s.insert, key, sqlStateInProgress, now.Add(ttl).UnixMilli())
+	if insertErr == nil {
+		return consumer.DedupAcquired, nil
+	}
+	var state int
+	err := s.db.QueryRowContext(ctx, s.selectState, key).Scan(&state)
+	if err != nil {
+		// 插入失败且查不到记录，说明不是主键冲突
+		return consumer.DedupInProgress, fmt.Errorf("RocketMQ写入去重记录失败:%w", insertErr)
+	}
+	if state == sqlStateDone {
+		return consumer.DedupDone, nil
+	}
+	return consumer.DedupInProgress, nil
+}
+
+func (s *SQLStore) Done(ctx context.Context, key string, ttl time.Duration) error {
+	_, err := s.db.ExecContext(ctx, s.markDone, sqlStateDone, time.Now().Add(ttl).UnixMilli(), key)
+	return err
+}
+
+func (s *SQLStore) Release(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(ctx, s.release, key, sqlStateInProgress)
+	return err
+}
+
+// Sweep 删除所有已过期的记录，可以定期调用
+func (s *SQLStore) Sweep(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, s.sweep, time.Now().UnixMilli())
+	return err
+}
@@ -0,0 +1,130 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+)
+
+const (
+	// PropertyKeyID 加密消息使用的主密钥ID
+	PropertyKeyID = "KROCKETMQ_ENC_KEY_ID"
+	// PropertyDataKey 被主密钥加密后的数据密钥(base64)
+	PropertyDataKey = "KROCKETMQ_ENC_DATA_KEY"
+
+	dataKeySize = 32
+)
+
+// ErrKeyNotFound 按keyID找不到密钥
+var ErrKeyNotFound = errors.New("RocketMQ消息加密密钥不存在")
+
+// KeyProvider 主密钥提供者。加密使用CurrentKey，解密按消息中的keyID查找，
+// 轮换时新旧密钥同时保留即可解密存量消息
+type KeyProvider interface {
+	CurrentKey() (id string, key []byte, err error)
+	Key(id string) ([]byte, error)
+}
+
+// IsEncrypted 消息是否为加密消息
+func IsEncrypted(msg *primitive.Message) bool {
+	return msg.GetProperty(PropertyKeyID) != ""
+}
+
+// Encrypt 信封加密：每条消息随机生成数据密钥用AES-GCM加密消息体，
+// 数据密钥再由当前主密钥加密后连同keyID写入消息属性
+func Encrypt(provider KeyProvider, msg *primitive.Message) error {
+	id, master, err := provider.CurrentKey()
+	if err != nil {
+		return err
+	}
+	dataKey := make([]byte, dataKeySize)
+	if _, err = io.ReadFull(rand.Reader, dataKey); err != nil {
+		return err
+	}
+	body, err := seal(dataKey, msg.Body, []byte(msg.Topic))
+	if err != nil {
+		return err
+	}
+	wrapped, err := seal(master, dataKey, []byte(id))
+	if err != nil {
+		return fmt.Errorf("RocketMQ数据密钥加密失败:%w", err)
+	}
+	msg.Body = body
+	msg.WithProperty(PropertyKeyID, id)
+	msg.WithProperty(PropertyDataKey, base64.StdEncoding.EncodeToString(wrapped))
+	return nil
+}
+
+// Decrypt 解密消息体并移除加密属性，未加密的消息直接返回
+func Decrypt(provider KeyProvider, msg *primitive.MessageExt) error {
+	id := msg.GetProperty(PropertyKeyID)
+	if id == "" {
+		return nil
+	}
+	if provider == nil {
+		return fmt.Errorf("RocketMQ消息%s已加密，但未配置KeyProvider", msg.MsgId)
+	}
+	master, err := provider.Key(id)
+	if err != nil {
+		return err
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(msg.GetProperty(PropertyDataKey))
+	if err != nil {
+		return fmt.Errorf("RocketMQ消息%s数据密钥格式错误:%w", msg.MsgId, err)
+	}
+	dataKey, err := open(master, wrapped, []byte(id))
+	if err != nil {
+		return fmt.Errorf("RocketMQ消息%s数据密钥解密失败:%w", msg.MsgId, err)
+	}
+	// 重试消息的Topic为%RETRY%group，原主题保存在RETRY_TOPIC属性中
+	topic := msg.Topic
+	if retryTopic := msg.GetProperty(primitive.PropertyRetryTopic); retryTopic != "" {
+		topic = retryTopic
+	}
+	body, err := open(dataKey, msg.Body, []byte(topic))
+	if err != nil {
+		return fmt.Errorf("RocketMQ消息%s解密失败:%w", msg.MsgId, err)
+	}
+	msg.Body = body
+	msg.RemoveProperty(PropertyKeyID)
+	msg.RemoveProperty(PropertyDataKey)
+	return nil
+}
+
+// seal 输出 nonce||密文
+func seal(key, plaintext, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize(), gcm.NonceSize()+len(plaintext)+gcm.Overhead())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+func open(key, data, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("密文长度不足")
+	}
+	return gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], aad)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,144 @@
+package encryption
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/ketianlin/krocketmq/model"
+)
+
+// DefaultEnvPrefix 环境变量密钥前缀：KROCKETMQ_KEY_<ID>=base64密钥，KROCKETMQ_KEY_CURRENT=<ID>
+const DefaultEnvPrefix = "KROCKETMQ_KEY_"
+
+// StaticKeyProvider 内存中的密钥集合
+type StaticKeyProvider struct {
+	mu      sync.RWMutex
+	current string
+	keys    map[string][]byte
+}
+
+// NewStaticKeyProvider keys为 keyID->密钥(16/24/32字节)，current为加密使用的keyID
+func NewStaticKeyProvider(current string, keys map[string][]byte) (*StaticKeyProvider, error) {
+	p := &StaticKeyProvider{keys: make(map[string][]byte, len(keys))}
+	for id, key := range keys {
+		if err := checkKey(id, key); err != nil {
+			return nil, err
+		}
+		p.keys[id] = key
+	}
+	if err := p.SetCurrent(current); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *StaticKeyProvider) CurrentKey() (string, []byte, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.current, p.keys[p.current], nil
+}
+
+func (p *StaticKeyProvider) Key(id string) ([]byte, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	key, ok := p.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrKeyNotFound, id)
+	}
+	return key, nil
+}
+
+// SetCurrent 切换加密使用的密钥，旧密钥仍可用于解密
+func (p *StaticKeyProvider) SetCurrent(id string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.keys[id]; !ok {
+		return fmt.Errorf("%w: %s", ErrKeyNotFound, id)
+	}
+	p.current = id
+	return nil
+}
+
+// keyFile 密钥文件格式：{"current":"k2","keys":{"k1":"base64","k2":"base64"}}
+type keyFile struct {
+	Current string            `json:"current"`
+	Keys    map[string]string `json:"keys"`
+}
+
+// NewFileKeyProvider 从JSON密钥文件加载
+func NewFileKeyProvider(path string) (*StaticKeyProvider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("RocketMQ密钥文件%s读取失败:%w", path, err)
+	}
+	var kf keyFile
+	if err = json.Unmarshal(data, &kf); err != nil {
+		return nil, fmt.Errorf("RocketMQ密钥文件%s解析失败:%w", path, err)
+	}
+	keys, err := decodeKeys(kf.Keys)
+	if err != nil {
+		return nil, err
+	}
+	return NewStaticKeyProvider(kf.Current, keys)
+}
+
+// NewEnvKeyProvider 从环境变量加载，prefix为空时使用DefaultEnvPrefix
+func NewEnvKeyProvider(prefix string) (*StaticKeyProvider, error) {
+	if prefix == "" {
+		prefix = DefaultEnvPrefix
+	}
+	current := os.Getenv(prefix + "CURRENT")
+	encoded := make(map[string]string)
+	for _, kv := range os.Environ() {
+		name, value, ok := strings.Cut(kv, "=")
+		if !ok || !strings.HasPrefix(name, prefix) || name == prefix+"CURRENT" {
+			continue
+		}
+		encoded[strings.TrimPrefix(name, prefix)] = value
+	}
+	keys, err := decodeKeys(encoded)
+	if err != nil {
+		return nil, err
+	}
+	return NewStaticKeyProvider(current, keys)
+}
+
+// LoadKeyProvider 根据配置创建KeyProvider，未开启加密时返回nil
+func LoadKeyProvider(conf *model.EncryptionConfig) (KeyProvider, error) {
+	if conf == nil || !conf.Enable {
+		return nil, nil
+	}
+	if conf.KeyFile != "" {
+		return NewFileKeyProvider(conf.KeyFile)
+	}
+	return NewEnvKeyProvider(conf.KeyEnvPrefix)
+}
+
+func decodeKeys(encoded map[string]string) (map[string][]byte, error) {
+	if len(encoded) == 0 {
+		return nil, errors.New("RocketMQ没有配置任何加密密钥")
+	}
+	keys := make(map[string][]byte, len(encoded))
+	for id, v := range encoded {
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(v))
+		if err != nil {
+			return nil, fmt.Errorf("RocketMQ密钥%s不是合法的base64:%w", id, err)
+		}
+		keys[id] = key
+	}
+	return keys, nil
+}
+
+func checkKey(id string, key []byte) error {
+	switch len(key) {
+	case 16, 24, 32:
+		return nil
+	default:
+		return fmt.Errorf("RocketMQ密钥%s长度必须为16、24或32字节，实际%d", id, len(key))
+	}
+}
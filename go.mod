@@ -3,14 +3,16 @@ module github.com/ketianlin/krocketmq
 go 1.20
 
 require (
-	github.com/apache/rocketmq-client-go/v2 v2.1.2
+	git.mills.io/prologic/bitcask v1.0.2
+	github.com/apache/rocketmq-client-go/v2 v2.1.2 // 固定版本: consumer/offset_store.go通过linkname使用内部变量_LocalOffsetStorePath
 	github.com/ketianlin/kgin v1.0.1
 	github.com/knadh/koanf v1.5.0
+	github.com/levigross/grequests v0.0.0-20221222020224-9eee758d18d5
 	github.com/sadlil/gologger v0.0.0-20180131031757-2507bf651df8
+	github.com/xeipuuv/gojsonschema v1.2.0
 )
 
 require (
-	git.mills.io/prologic/bitcask v1.0.2 // indirect
 	github.com/abcum/lcp v0.0.0-20201209214815-7a3f3840be81 // indirect
 	github.com/araddon/gou v0.0.0-20211019181548-e7d08105776c // indirect
 	github.com/bitly/go-hostpool v0.1.0 // indirect
@@ -26,7 +28,6 @@ require (
 	github.com/jinzhu/inflection v1.0.0 // indirect
 	github.com/jinzhu/now v1.1.5 // indirect
 	github.com/json-iterator/go v1.1.12 // indirect
-	github.com/levigross/grequests v0.0.0-20221222020224-9eee758d18d5 // indirect
 	github.com/mattbaird/elastigo v0.0.0-20170123220020-2fe47fd29e4b // indirect
 	github.com/mattn/go-isatty v0.0.12 // indirect
 	github.com/mitchellh/copystructure v1.2.0 // indirect
@@ -43,6 +44,8 @@ require (
 	github.com/tidwall/gjson v1.13.0 // indirect
 	github.com/tidwall/match v1.1.1 // indirect
 	github.com/tidwall/pretty v1.2.0 // indirect
+	github.com/xeipuuv/gojsonpointer v0.0.0-20180127040702-4e3ac2762d5f // indirect
+	github.com/xeipuuv/gojsonreference v0.0.0-20180127040603-bd5ef7bd5415 // indirect
 	go.uber.org/atomic v1.7.0 // indirect
 	golang.org/x/exp v0.0.0-20200228211341-fcea875c7e85 // indirect
 	golang.org/x/net v0.17.0 // indirect
@@ -0,0 +1,58 @@
+// Package clientconf 生产者和消费者共用的配置读取与转换
+package clientconf
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+	"github.com/ketianlin/krocketmq/model"
+	"github.com/knadh/koanf"
+)
+
+// ReadSchemas 读取prefix下的JSON Schema配置
+func ReadSchemas(conf *koanf.Koanf, prefix string) []model.SchemaConfig {
+	var list []model.SchemaConfig
+	for _, v := range conf.Slices(prefix) {
+		list = append(list, model.SchemaConfig{
+			Topic: v.String("topic"),
+			Tag:   v.String("tag"),
+			File:  v.String("file"),
+		})
+	}
+	return list
+}
+
+// ReadTraceConfig 读取prefix下的消息轨迹配置
+func ReadTraceConfig(conf *koanf.Koanf, prefix string) model.TraceConfig {
+	return model.TraceConfig{
+		Enable:        conf.Bool(prefix + ".enable"),
+		TraceTopic:    conf.String(prefix + ".topic"),
+		AccessChannel: conf.String(prefix + ".access_channel"),
+	}
+}
+
+// TraceConfig 消息轨迹分发器配置，未开启时返回nil。轨迹与消息使用同一个name server解析器
+func TraceConfig(trace model.TraceConfig, group string, nsResolver primitive.NsResolver) (*primitive.TraceConfig, error) {
+	if !trace.Enable {
+		return nil, nil
+	}
+	// name server为空时轨迹分发器会直接panic，这里提前拦截
+	if len(nsResolver.Resolve()) == 0 {
+		return nil, errors.New("RocketMQ开启消息轨迹时name server不能为空")
+	}
+	return &primitive.TraceConfig{
+		TraceTopic: trace.TraceTopic,
+		GroupName:  group,
+		Access:     AccessChannel(trace.AccessChannel),
+		Resolver:   nsResolver,
+	}, nil
+}
+
+// AccessChannel 解析轨迹的访问通道，cloud以外都为local
+func AccessChannel(channel string) primitive.AccessChannel {
+	if strings.ToLower(channel) == "cloud" {
+		return primitive.Cloud
+	}
+	return primitive.Local
+}
@@ -0,0 +1,83 @@
+package clientconf
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+	"github.com/ketianlin/krocketmq/model"
+	"github.com/knadh/koanf"
+	"github.com/knadh/koanf/parsers/yaml"
+	"github.com/knadh/koanf/providers/rawbytes"
+)
+
+func loadYaml(t *testing.T, text string) *koanf.Koanf {
+	t.Helper()
+	conf := koanf.New(".")
+	if err := conf.Load(rawbytes.Provider([]byte(text)), yaml.Parser()); err != nil {
+		t.Fatal(err)
+	}
+	return conf
+}
+
+func TestReadTraceConfig(t *testing.T) {
+	conf := loadYaml(t, `
+go:
+  rocketmq:
+    producer:
+      trace:
+        enable: true
+        topic: my_trace
+        access_channel: cloud
+`)
+	want := model.TraceConfig{Enable: true, TraceTopic: "my_trace", AccessChannel: "cloud"}
+	if got := ReadTraceConfig(conf, "go.rocketmq.producer.trace"); got != want {
+		t.Fatalf("期望%+v, 实际%+v", want, got)
+	}
+	if got := ReadTraceConfig(conf, "go.rocketmq.consumer.trace"); got != (model.TraceConfig{}) {
+		t.Fatalf("未配置时期望零值, 实际%+v", got)
+	}
+}
+
+func TestReadSchemas(t *testing.T) {
+	conf := loadYaml(t, `
+go:
+  rocketmq:
+    schemas:
+      - topic: Order
+        file: order.json
+      - topic: Order
+        tag: batch
+        file: batch.json
+`)
+	want := []model.SchemaConfig{{Topic: "Order", File: "order.json"}, {Topic: "Order", Tag: "batch", File: "batch.json"}}
+	if got := ReadSchemas(conf, "go.rocketmq.schemas"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("期望%+v, 实际%+v", want, got)
+	}
+}
+
+func TestTraceConfig(t *testing.T) {
+	nameServers := []string{"127.0.0.1:9876", "127.0.0.2:9876"}
+	resolver := primitive.NewPassthroughResolver(nameServers)
+	tc, err := TraceConfig(model.TraceConfig{}, "g", resolver)
+	if err != nil || tc != nil {
+		t.Fatalf("未开启轨迹时应返回nil, 实际%v, %v", tc, err)
+	}
+	tc, err = TraceConfig(model.TraceConfig{Enable: true, AccessChannel: "Cloud"}, "g", resolver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 轨迹没有单独的name server，使用消息的name server
+	if got := tc.Resolver.Resolve(); !reflect.DeepEqual(got, nameServers) {
+		t.Fatalf("期望轨迹使用%v, 实际%v", nameServers, got)
+	}
+	if tc.GroupName != "g" || tc.Access != primitive.Cloud || tc.TraceTopic != "" {
+		t.Fatalf("轨迹配置错误: %+v", tc)
+	}
+	if AccessChannel("") != primitive.Local {
+		t.Fatal("默认访问通道应为local")
+	}
+	if _, err = TraceConfig(model.TraceConfig{Enable: true}, "g", primitive.NewPassthroughResolver(nil)); err == nil {
+		t.Fatal("name server为空时开启轨迹应当报错")
+	}
+}
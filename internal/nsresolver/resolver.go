@@ -0,0 +1,150 @@
+package nsresolver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+	"github.com/ketianlin/kgin/logs"
+)
+
+// DefaultRefreshInterval 未配置刷新间隔时的默认值
+const DefaultRefreshInterval = 30 * time.Second
+
+var _ primitive.NsResolver = (*Resolver)(nil)
+
+// Resolver 通过HTTP地址服务获取name server列表，并定时刷新。
+// 地址服务不可用时继续使用最后一次成功获取的列表
+type Resolver struct {
+	endpoint string
+	interval time.Duration
+	cli      *http.Client
+	mu       sync.RWMutex
+	addrs    []string
+	stopCh   chan struct{}
+	stopOnce sync.Once
+}
+
+// New 创建Resolver并同步拉取一次地址列表。拉取失败时使用fallback(一般为静态配置的name_servers)，
+// 两者都为空则返回错误
+func New(endpoint string, interval time.Duration, fallback []string) (*Resolver, error) {
+	if interval <= 0 {
+		interval = DefaultRefreshInterval
+	}
+	r := &Resolver{
+		endpoint: endpoint,
+		interval: interval,
+		cli:      &http.Client{Timeout: 10 * time.Second},
+		stopCh:   make(chan struct{}),
+	}
+	addrs, err := r.fetch()
+	if err != nil {
+		if len(fallback) == 0 {
+			return nil, err
+		}
+		logs.Error("RocketMQ name server地址服务{}获取失败，使用静态配置:{}", endpoint, err.Error())
+		addrs = append([]string(nil), fallback...)
+	}
+	r.addrs = addrs
+	go r.refreshLoop()
+	return r, nil
+}
+
+// Resolve 返回当前缓存的name server列表
+func (r *Resolver) Resolve() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]string(nil), r.addrs...)
+}
+
+func (r *Resolver) Description() string {
+	return fmt.Sprintf("krocketmq http resolver of endpoint:%s", r.endpoint)
+}
+
+// Refresh 立即拉取一次地址列表，失败时保留原有列表
+func (r *Resolver) Refresh() error {
+	addrs, err := r.fetch()
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.addrs = addrs
+	r.mu.Unlock()
+	return nil
+}
+
+// Stop 停止定时刷新
+func (r *Resolver) Stop() {
+	r.stopOnce.Do(func() {
+		close(r.stopCh)
+	})
+}
+
+func (r *Resolver) refreshLoop() {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := r.Refresh(); err != nil {
+				logs.Error("RocketMQ name server地址刷新失败，继续使用上次的列表:{}", err.Error())
+			}
+		case <-r.stopCh:
+			return
+		}
+	}
+}
+
+func (r *Resolver) fetch() ([]string, error) {
+	resp, err := r.cli.Get(r.endpoint)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("name server地址服务返回状态码%d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := Parse(body)
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, errors.New("name server地址服务返回的列表为空")
+	}
+	return addrs, nil
+}
+
+// Parse 解析地址服务的返回内容，支持JSON数组以及分号、逗号、换行分隔的文本
+func Parse(body []byte) ([]string, error) {
+	text := strings.TrimSpace(string(body))
+	if strings.HasPrefix(text, "[") {
+		var list []string
+		if err := json.Unmarshal([]byte(text), &list); err != nil {
+			return nil, fmt.Errorf("name server地址列表解析失败:%w", err)
+		}
+		return compact(list), nil
+	}
+	return compact(strings.FieldsFunc(text, func(c rune) bool {
+		return c == ';' || c == ',' || c == '\n' || c == '\r' || c == ' ' || c == '\t'
+	})), nil
+}
+
+func compact(list []string) []string {
+	addrs := make([]string, 0, len(list))
+	for _, v := range list {
+		if v = strings.TrimSpace(v); v != "" {
+			addrs = append(addrs, v)
+		}
+	}
+	return addrs
+}
@@ -0,0 +1,169 @@
+package krocketmq
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+	"github.com/ketianlin/krocketmq/model"
+)
+
+const (
+	// MaxTopicLength 主题最大长度
+	MaxTopicLength = 127
+	// MaxTagLength tag最大长度
+	MaxTagLength = 127
+	// MaxBodySize 消息体最大字节数(broker默认maxMessageSize)
+	MaxBodySize = 4 * 1024 * 1024
+)
+
+var (
+	topicPattern = regexp.MustCompile(`^[%|a-zA-Z0-9_-]+$`)
+
+	// delayLevels broker默认messageDelayLevel，下标+1即延时级别
+	delayLevels = []time.Duration{
+		time.Second, 5 * time.Second, 10 * time.Second, 30 * time.Second,
+		time.Minute, 2 * time.Minute, 3 * time.Minute, 4 * time.Minute, 5 * time.Minute,
+		6 * time.Minute, 7 * time.Minute, 8 * time.Minute, 9 * time.Minute, 10 * time.Minute,
+		20 * time.Minute, 30 * time.Minute, time.Hour, 2 * time.Hour,
+	}
+
+	// reservedProperties rocketmq及krocketmq内部使用的属性，不允许通过Property设置
+	reservedProperties = map[string]bool{
+		primitive.PropertyKeys: true, primitive.PropertyTags: true, primitive.PropertyWaitStoreMsgOk: true,
+		primitive.PropertyDelayTimeLevel: true, primitive.PropertyRetryTopic: true, primitive.PropertyRealTopic: true,
+		primitive.PropertyRealQueueId: true, primitive.PropertyTransactionPrepared: true,
+		primitive.PropertyProducerGroup: true, primitive.PropertyMinOffset: true, primitive.PropertyMaxOffset: true,
+		primitive.PropertyReconsumeTime: true, primitive.PropertyUniqueClientMessageIdKeyIndex: true,
+		primitive.PropertyMaxReconsumeTimes: true, primitive.PropertyConsumeStartTime: true,
+		primitive.PropertyShardingKey: true, primitive.PropertyTraceSwitch: true, primitive.PropertyMsgRegion: true,
+	}
+)
+
+// MessageBuilder 链式构建model.TopicMessage，第一个错误会保留到Build时返回
+type MessageBuilder struct {
+	msg *model.TopicMessage
+	err error
+}
+
+// NewMessage 创建消息构建器
+//
+//	msg, err := krocketmq.NewMessage("order_created").Tag("paid").Keys("order-1").JSON(order).Build()
+func NewMessage(topic string) *MessageBuilder {
+	b := &MessageBuilder{msg: &model.TopicMessage{TopicName: topic}}
+	switch {
+	case topic == "":
+		b.err = errors.New("RocketMQ主题不能为空")
+	case len(topic) > MaxTopicLength:
+		b.err = fmt.Errorf("RocketMQ主题%s长度超过%d", topic, MaxTopicLength)
+	case !topicPattern.MatchString(topic):
+		b.err = fmt.Errorf("RocketMQ主题%s只能包含字母、数字、%%、|、_和-", topic)
+	}
+	return b
+}
+
+func (b *MessageBuilder) fail(err error) *MessageBuilder {
+	if b.err == nil {
+		b.err = err
+	}
+	return b
+}
+
+// Tag 设置tag，tag中不能包含空白字符、|和*
+func (b *MessageBuilder) Tag(tag string) *MessageBuilder {
+	switch {
+	case tag == "":
+		return b.fail(errors.New("RocketMQ tag不能为空"))
+	case len(tag) > MaxTagLength:
+		return b.fail(fmt.Errorf("RocketMQ tag %s长度超过%d", tag, MaxTagLength))
+	case strings.ContainsAny(tag, "|* \t\r\n"):
+		return b.fail(fmt.Errorf("RocketMQ tag %s不能包含空白字符、|和*", tag))
+	}
+	b.msg.Tags = tag
+	return b
+}
+
+// Keys 追加消息key，key中不能包含空格
+func (b *MessageBuilder) Keys(keys ...string) *MessageBuilder {
+	for _, k := range keys {
+		if k == "" || strings.ContainsAny(k, primitive.PropertyKeySeparator+"\t\r\n") {
+			return b.fail(fmt.Errorf("RocketMQ key %q不能为空或包含空白字符", k))
+		}
+		b.msg.Keys = append(b.msg.Keys, k)
+	}
+	return b
+}
+
+// ShardingKey 设置顺序消息的分区key
+func (b *MessageBuilder) ShardingKey(key string) *MessageBuilder {
+	if key == "" {
+		return b.fail(errors.New("RocketMQ ShardingKey不能为空"))
+	}
+	b.msg.ShardingKey = key
+	return b
+}
+
+// Property 设置自定义属性，不能覆盖rocketmq和krocketmq内部使用的属性
+func (b *MessageBuilder) Property(name, value string) *MessageBuilder {
+	if name == "" || reservedProperties[name] || strings.HasPrefix(name, "KROCKETMQ_") {
+		return b.fail(fmt.Errorf("RocketMQ属性名%q为空或为保留属性", name))
+	}
+	if b.msg.Properties == nil {
+		b.msg.Properties = make(map[string]string)
+	}
+	b.msg.Properties[name] = value
+	return b
+}
+
+// Delay 设置延时投递，按broker默认延时级别向上取整，最长2h
+func (b *MessageBuilder) Delay(d time.Duration) *MessageBuilder {
+	if d <= 0 {
+		return b.fail(fmt.Errorf("RocketMQ延时时间%s必须大于0", d))
+	}
+	for i, v := range delayLevels {
+		if d <= v {
+			b.msg.DelayTimeLevel = i + 1
+			return b
+		}
+	}
+	return b.fail(fmt.Errorf("RocketMQ延时时间%s超过最大延时级别%s", d, delayLevels[len(delayLevels)-1]))
+}
+
+// DelayLevel 直接设置延时级别(1-18)
+func (b *MessageBuilder) DelayLevel(level int) *MessageBuilder {
+	if level < 1 || level > len(delayLevels) {
+		return b.fail(fmt.Errorf("RocketMQ延时级别%d必须在1-%d之间", level, len(delayLevels)))
+	}
+	b.msg.DelayTimeLevel = level
+	return b
+}
+
+// Body 设置消息体
+func (b *MessageBuilder) Body(body []byte) *MessageBuilder {
+	if len(body) > MaxBodySize {
+		return b.fail(fmt.Errorf("RocketMQ消息体大小%d超过%d", len(body), MaxBodySize))
+	}
+	b.msg.Msg = string(body)
+	return b
+}
+
+// JSON 将v序列化为JSON作为消息体
+func (b *MessageBuilder) JSON(v interface{}) *MessageBuilder {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return b.fail(fmt.Errorf("RocketMQ消息体JSON序列化失败:%w", err))
+	}
+	return b.Body(data)
+}
+
+// Build 返回构建好的消息，可直接用于producer的所有发送方法
+func (b *MessageBuilder) Build() (*model.TopicMessage, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	return b.msg, nil
+}
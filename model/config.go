@@ -1,9 +1,37 @@
 package model
 
 type Config struct {
-	NameServers    []string
-	ProductConfig  ProductConfig
-	ConsumerConfig ConsumerConfig
+	NameServers        []string
+	NameServerEndpoint string         // name server地址服务(HTTP)，配置后优先于NameServers，NameServers作为兜底
+	NameServerRefresh  int            // 地址服务刷新间隔 单位（秒），默认30
+	Schemas            []SchemaConfig // 消息体JSON Schema
+	Encryption         EncryptionConfig
+	Signing            SigningConfig
+	ProductConfig      ProductConfig
+	ConsumerConfig     ConsumerConfig
+}
+
+// SchemaConfig 主题(可选tag)对应的JSON Schema文件
+type SchemaConfig struct {
+	Topic string
+	Tag   string // 为空表示该主题下所有tag
+	File  string
+}
+
+// EncryptionConfig 消息体加密配置(AES-GCM信封加密)
+type EncryptionConfig struct {
+	Enable       bool
+	Topics       []string // 需要加密的主题，为空表示所有主题(仅生产者使用)
+	KeyFile      string   // JSON密钥文件
+	KeyEnvPrefix string   // KeyFile为空时从环境变量读取密钥的前缀，默认KROCKETMQ_KEY_
+}
+
+// SigningConfig 消息HMAC签名配置
+type SigningConfig struct {
+	Enable       bool     // 生产者开启后对消息签名，消费者开启后拒绝未签名或签名错误的消息
+	Properties   []string // 除消息体外参与签名的属性，如TAGS、KEYS
+	KeyFile      string   // JSON密钥文件，格式同EncryptionConfig.KeyFile
+	KeyEnvPrefix string   // KeyFile为空时从环境变量读取密钥的前缀，默认KROCKETMQ_SIGN_KEY_
 }
 
 type ProductConfig struct {
@@ -11,12 +39,50 @@ type ProductConfig struct {
 	Timeout        int
 	TopicQueueNums int
 	Group          string
-	LogLevel       string // 日志级别: debug, warn, error, fatal, info(默认)
+	LogLevel       string   // 日志级别: debug, warn, error, fatal, info(默认)
+	OrderedTopics  []string // 顺序主题，发送时必须设置ShardingKey
+	Trace          TraceConfig
+	Routes         map[string]PublishRoute // 扇出路由，key为路由名称
+}
+
+// PublishRoute 扇出路由：一条消息同时发送到多个主题
+type PublishRoute struct {
+	Topics     []string
+	RequireAll bool // 为true时所有主题都发送成功才算成功
 }
 
 type ConsumerConfig struct {
-	Timeout        int
-	Group          string
-	MonitoringTime int    // 监测时间 单位（秒）
-	LogLevel       string // 日志级别: debug, warn, error, fatal, info(默认)
+	Timeout           int
+	Group             string
+	MonitoringTime    int    // 监测时间 单位（秒）
+	LogLevel          string // 日志级别: debug, warn, error, fatal, info(默认)
+	Trace             TraceConfig
+	ValidateSchema    bool   // 接收时按Schemas校验消息体
+	MessageModel      string // 消息模式: clustering(默认，集群消费), broadcasting(广播消费)
+	OffsetStoreDir    string // 广播消费时本地offset的存放目录，默认为环境变量rocketmq.client.localOffsetStoreDir或$HOME/.rocketmq_client_go。rocketmq-client-go中该目录是进程级的，只在Start时读取
+	ConsumeMode       string // 消费模式: orderly(默认，顺序消费), concurrently(并发消费)
+	ConsumeFrom       string // 新消费组首次消费的起始位置: last_offset(默认), first_offset, timestamp，拉取消费者不支持timestamp
+	ConsumeTimestamp  string // ConsumeFrom为timestamp时的起始时间，RFC3339时间或相对时长如 "-2h"
+	SuspendTime       int    // 顺序消费失败后挂起队列的时间 单位（毫秒），默认1000
+	MaxReconsumeTimes int    // 最大重试次数，超过后进入死信队列。默认并发消费16次，顺序消费不限次数
+	PanicPolicy       string // handler panic后的处理: retry(默认，重新投递), ack(确认丢弃), dead_letter(交给OnDeadLetter)
+	Concurrency       int    // 处理消息的协程数，默认20。同时作为每个主题的ConsumeGoroutineNums，所有主题共享协程池，N个主题最多N*Concurrency个消费回调等待这些协程
+	QueueSize         int    // 协程池等待队列长度，队列满时阻塞消费回调，默认等于Concurrency
+	// ConsumeBatchMaxSize 每次消费回调最多收到的消息数(1~1024)，默认1。SubscribeBatch的handler按此批量接收
+	ConsumeBatchMaxSize int
+	// Subscriptions 按主题配置的服务端过滤条件，key为主题名
+	Subscriptions map[string]SubscriptionConfig
+}
+
+// SubscriptionConfig 订阅过滤条件，Tag和Sql只能配置一个，都为空时接收全部消息
+type SubscriptionConfig struct {
+	Tag string // tag表达式，如 "TagA || TagB"
+	Sql string // SQL92属性过滤表达式，需要broker开启enablePropertyFilter
+}
+
+// TraceConfig 消息轨迹配置
+type TraceConfig struct {
+	Enable        bool   // 是否开启消息轨迹
+	TraceTopic    string // 轨迹主题，默认RMQ_SYS_TRACE_TOPIC
+	AccessChannel string // 接入方式: local(默认), cloud
 }
@@ -1,11 +1,15 @@
 package model
 
+import "github.com/apache/rocketmq-client-go/v2/primitive"
+
 type TopicMessage struct {
-	Msg         string   `json:"msg"`
-	TopicName   string   `json:"topicName"`
-	Tags        string   `json:"tags"`
-	Keys        []string `json:"keys"`
-	ShardingKey string   `json:"shardingKey"`
+	Msg            string            `json:"msg"`
+	TopicName      string            `json:"topicName"`
+	Tags           string            `json:"tags"`
+	Keys           []string          `json:"keys"`
+	ShardingKey    string            `json:"shardingKey"`
+	Properties     map[string]string `json:"properties"`     // 自定义属性
+	DelayTimeLevel int               `json:"delayTimeLevel"` // 延时级别 1-18，0表示不延时
 }
 
 type InitCallbackMessage struct {
@@ -13,3 +17,10 @@ type InitCallbackMessage struct {
 	InitError    error  // 初始化错误信息
 	MqCheckError error  // 检查mq是否重连错误信息
 }
+
+// PublishResult 扇出发送时单个主题的发送结果
+type PublishResult struct {
+	TopicName string
+	Result    *primitive.SendResult
+	Err       error
+}
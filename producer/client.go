@@ -2,13 +2,19 @@ package producer
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/apache/rocketmq-client-go/v2"
 	"github.com/apache/rocketmq-client-go/v2/primitive"
 	"github.com/apache/rocketmq-client-go/v2/producer"
 	"github.com/apache/rocketmq-client-go/v2/rlog"
 	"github.com/ketianlin/kgin/logs"
+	"github.com/ketianlin/krocketmq/encryption"
+	"github.com/ketianlin/krocketmq/internal/clientconf"
+	"github.com/ketianlin/krocketmq/internal/nsresolver"
 	"github.com/ketianlin/krocketmq/model"
+	"github.com/ketianlin/krocketmq/schema"
+	"github.com/ketianlin/krocketmq/signing"
 	"github.com/knadh/koanf"
 	"github.com/knadh/koanf/parsers/yaml"
 	"github.com/knadh/koanf/providers/rawbytes"
@@ -16,6 +22,8 @@ import (
 	"github.com/sadlil/gologger"
 	"io/ioutil"
 	"strings"
+	"sync"
+	"time"
 )
 
 type producerClient struct {
@@ -23,9 +31,20 @@ type producerClient struct {
 	confUrl    string
 	conn       rocketmq.Producer
 	closeError error
+	config     *model.Config
+	resolver   *nsresolver.Resolver
+	schemas    *schema.Registry
+	keys       encryption.KeyProvider
+	signKeys   signing.KeyProvider
 }
 
 var ProducerClient = &producerClient{}
+
+// ErrShardingKeyRequired 顺序消息缺少ShardingKey
+var ErrShardingKeyRequired = errors.New("RocketMQ顺序消息必须设置ShardingKey")
+
+// ErrPublishIncomplete 扇出发送存在失败的主题
+var ErrPublishIncomplete = errors.New("RocketMQ扇出发送未全部成功")
 var logger = gologger.GetLogger()
 
 func (r *producerClient) Init(rocketmqConfigUrl string) {
@@ -62,48 +81,133 @@ func (r *producerClient) Init(rocketmqConfigUrl string) {
 				return
 			}
 		}
-		nameServers := r.conf.Strings("go.rocketmq.name_servers")
-		retryCount := r.conf.Int("go.rocketmq.producer.retry_count")
-		//timeout := r.conf.Int("go.rocketmq.producer.timeout")
-		topicQueueNums := r.conf.Int("go.rocketmq.producer.topic_queue_nums")
-		productGroup := r.conf.String("go.rocketmq.producer.group")
-		// 日志级别设置
-		logLevel := r.getLogLevel(r.conf.String("go.rocketmq.producer.log_level"))
-		rlog.SetLogLevel(logLevel)
-		p, err := rocketmq.NewProducer(
-			producer.WithNameServer(nameServers), // 接入点地址
-			producer.WithRetry(retryCount),       // 重试次数
-			producer.WithGroupName(productGroup), // 分组名称
-			//producer.WithSendMsgTimeout(time.Duration(timeout)*time.Second),
-			producer.WithQueueSelector(producer.NewHashQueueSelector()), // 表明使用要发送的队列就是msg中定义的queue
-			producer.WithDefaultTopicQueueNums(topicQueueNums),
-		)
+		conf := r.readConfig()
+		p, err := r.newProducer(conf)
 		if err != nil {
 			logger.Error(fmt.Sprintf("RocketMQ创建生产者错误:%s\n", err.Error()))
 		} else {
 			r.conn = p
+			r.config = conf
+		}
+	}
+}
+
+// readConfig 将yaml配置转换为model.Config
+func (r *producerClient) readConfig() *model.Config {
+	return &model.Config{
+		NameServers:        r.conf.Strings("go.rocketmq.name_servers"),
+		NameServerEndpoint: r.conf.String("go.rocketmq.name_server_endpoint"),
+		NameServerRefresh:  r.conf.Int("go.rocketmq.name_server_refresh"),
+		Schemas:            clientconf.ReadSchemas(r.conf, "go.rocketmq.schemas"),
+		Encryption: model.EncryptionConfig{
+			Enable:       r.conf.Bool("go.rocketmq.encryption.enable"),
+			Topics:       r.conf.Strings("go.rocketmq.encryption.topics"),
+			KeyFile:      r.conf.String("go.rocketmq.encryption.key_file"),
+			KeyEnvPrefix: r.conf.String("go.rocketmq.encryption.key_env_prefix"),
+		},
+		Signing: model.SigningConfig{
+			Enable:       r.conf.Bool("go.rocketmq.signing.enable"),
+			Properties:   r.conf.Strings("go.rocketmq.signing.properties"),
+			KeyFile:      r.conf.String("go.rocketmq.signing.key_file"),
+			KeyEnvPrefix: r.conf.String("go.rocketmq.signing.key_env_prefix"),
+		},
+		ProductConfig: model.ProductConfig{
+			RetryCount:     r.conf.Int("go.rocketmq.producer.retry_count"),
+			Timeout:        r.conf.Int("go.rocketmq.producer.timeout"),
+			TopicQueueNums: r.conf.Int("go.rocketmq.producer.topic_queue_nums"),
+			Group:          r.conf.String("go.rocketmq.producer.group"),
+			LogLevel:       r.conf.String("go.rocketmq.producer.log_level"),
+			OrderedTopics:  r.conf.Strings("go.rocketmq.producer.ordered_topics"),
+			Trace:          clientconf.ReadTraceConfig(r.conf, "go.rocketmq.producer.trace"),
+			Routes:         r.readRoutes("go.rocketmq.producer.routes"),
+		},
+	}
+}
+
+// readRoutes 读取prefix下的扇出路由配置
+func (r *producerClient) readRoutes(prefix string) map[string]model.PublishRoute {
+	names := r.conf.MapKeys(prefix)
+	if len(names) == 0 {
+		return nil
+	}
+	routes := make(map[string]model.PublishRoute, len(names))
+	for _, name := range names {
+		routes[name] = model.PublishRoute{
+			Topics:     r.conf.Strings(prefix + "." + name + ".topics"),
+			RequireAll: r.conf.Bool(prefix + "." + name + ".require_all"),
+		}
+	}
+	return routes
+}
+
+// newProducer Init和InitConfig共用的生产者创建逻辑
+func (r *producerClient) newProducer(conf *model.Config) (rocketmq.Producer, error) {
+	// 日志级别设置
+	logLevel := r.getLogLevel(conf.ProductConfig.LogLevel)
+	rlog.SetLogLevel(logLevel)
+	keys, err := encryption.LoadKeyProvider(&conf.Encryption)
+	if err != nil {
+		return nil, err
+	}
+	r.keys = keys
+	signKeys, err := signing.LoadKeyProvider(&conf.Signing)
+	if err != nil {
+		return nil, err
+	}
+	r.signKeys = signKeys
+	schemas, err := schema.Load(conf.Schemas)
+	if err != nil {
+		return nil, err
+	}
+	r.schemas = schemas
+	var nsResolver primitive.NsResolver = primitive.NewPassthroughResolver(conf.NameServers) // 接入点地址
+	if conf.NameServerEndpoint != "" {
+		resolver, err := nsresolver.New(conf.NameServerEndpoint, time.Duration(conf.NameServerRefresh)*time.Second, conf.NameServers)
+		if err != nil {
+			return nil, err
 		}
+		r.resolver = resolver
+		nsResolver = resolver
+	}
+	opts := []producer.Option{
+		producer.WithNsResolver(nsResolver),
+		producer.WithRetry(conf.ProductConfig.RetryCount), // 重试次数
+		producer.WithGroupName(conf.ProductConfig.Group),  // 分组名称
+		//producer.WithSendMsgTimeout(time.Duration(conf.ProductConfig.Timeout)*time.Second),
+		producer.WithQueueSelector(producer.NewHashQueueSelector()), // 表明使用要发送的队列就是msg中定义的queue
+		producer.WithDefaultTopicQueueNums(conf.ProductConfig.TopicQueueNums),
+	}
+	traceConfig, err := clientconf.TraceConfig(conf.ProductConfig.Trace, conf.ProductConfig.Group, nsResolver)
+	if err != nil {
+		r.stopResolver()
+		return nil, err
+	}
+	if traceConfig != nil {
+		opts = append(opts, producer.WithTrace(traceConfig))
+	}
+	p, err := rocketmq.NewProducer(opts...)
+	if err != nil {
+		r.stopResolver()
+	}
+	return p, err
+}
+
+func (r *producerClient) stopResolver() {
+	if r.resolver != nil {
+		r.resolver.Stop()
+		r.resolver = nil
 	}
 }
 
 func (r *producerClient) InitConfig(conf *model.Config, callback func(err error)) {
 	if r.conn == nil {
-		// 日志级别设置
-		logLevel := r.getLogLevel(conf.ProductConfig.LogLevel)
-		rlog.SetLogLevel(logLevel)
-		p, err := rocketmq.NewProducer(
-			producer.WithNameServer(conf.NameServers),         // 接入点地址
-			producer.WithRetry(conf.ProductConfig.RetryCount), // 重试次数
-			producer.WithGroupName(conf.ProductConfig.Group),  // 分组名称
-			//producer.WithSendMsgTimeout(time.Duration(conf.ProductConfig.Timeout)*time.Second),
-			producer.WithQueueSelector(producer.NewHashQueueSelector()), // 表明使用要发送的队列就是msg中定义的queue
-			producer.WithDefaultTopicQueueNums(conf.ProductConfig.TopicQueueNums),
-		)
+		p, err := r.newProducer(conf)
 		if err != nil {
 			logger.Error(fmt.Sprintf("RocketMQ创建生产者错误:%s\n", err.Error()))
 			callback(err)
 		} else {
 			r.conn = p
+			r.config = conf
 		}
 	}
 }
@@ -113,6 +217,8 @@ func (r *producerClient) GetConnection() rocketmq.Producer {
 }
 
 func (r *producerClient) Close() {
+	// Shutdown失败时也要停止地址服务的刷新协程
+	defer r.stopResolver()
 	if r.conn != nil {
 		err := r.conn.Shutdown()
 		if err != nil {
@@ -141,57 +247,157 @@ func (r *producerClient) getLogLevel(level string) string {
 	return levelFlag
 }
 
+// SetSchemaRegistry 设置发送前使用的JSON Schema注册表，覆盖配置中加载的schema
+func (r *producerClient) SetSchemaRegistry(registry *schema.Registry) {
+	r.schemas = registry
+}
+
+// SetKeyProvider 设置消息加密使用的KeyProvider，覆盖配置中加载的密钥
+func (r *producerClient) SetKeyProvider(provider encryption.KeyProvider) {
+	r.keys = provider
+}
+
+// SetSignKeyProvider 设置消息签名使用的KeyProvider，覆盖配置中加载的密钥
+func (r *producerClient) SetSignKeyProvider(provider signing.KeyProvider) {
+	r.signKeys = provider
+}
+
 // GetCloseError 获取关闭的error
 func (r *producerClient) GetCloseError() error {
 	return r.closeError
 }
 
 func (r *producerClient) SendSync(message *model.TopicMessage) error {
-	var err error
+	msg, err := r.buildMessage(message)
+	if err != nil {
+		return err
+	}
 	err = r.conn.Start()
 	if err != nil {
 		logger.Error(fmt.Sprintf("RocketMQ生产者Start错误:%s\n", err.Error()))
 		return err
 	}
-	msg := &primitive.Message{
-		Topic: message.TopicName,
-		Body:  []byte(message.Msg),
-	}
-	msg.WithTag(message.Tags)
-	msg.WithKeys(message.Keys)
-	if message.ShardingKey != "" {
-		msg.WithShardingKey(message.ShardingKey)
-	}
 	_, err = r.conn.SendSync(context.Background(), msg)
 	return err
 }
 
 func (r *producerClient) SendSyncReturnResult(message *model.TopicMessage) (*primitive.SendResult, error) {
-	var err error
+	msg, err := r.buildMessage(message)
+	if err != nil {
+		return nil, err
+	}
 	err = r.conn.Start()
 	if err != nil {
 		logger.Error(fmt.Sprintf("RocketMQ生产者Start错误:%s\n", err.Error()))
 		return nil, err
 	}
-	msg := &primitive.Message{
-		Topic: message.TopicName,
-		Body:  []byte(message.Msg),
-	}
-	msg.WithTag(message.Tags)
-	msg.WithKeys(message.Keys)
-	if message.ShardingKey != "" {
-		msg.WithShardingKey(message.ShardingKey)
-	}
 	return r.conn.SendSync(context.Background(), msg)
 }
 
 func (r *producerClient) SendOne(message *model.TopicMessage) error {
-	var err error
+	msg, err := r.buildMessage(message)
+	if err != nil {
+		return err
+	}
 	err = r.conn.Start()
 	if err != nil {
 		logger.Error(fmt.Sprintf("RocketMQ生产者Start错误:%s\n", err.Error()))
 		return err
 	}
+	err = r.conn.SendOneWay(context.Background(), msg)
+	return err
+}
+
+// SendOrderly 顺序发送：key相同的消息总是发送到同一个队列，key为空时直接拒绝。
+// 返回结果中的MessageQueue即本次实际使用的队列
+func (r *producerClient) SendOrderly(ctx context.Context, key string, message *model.TopicMessage) (*primitive.SendResult, error) {
+	if key == "" {
+		return nil, fmt.Errorf("%w: %s", ErrShardingKeyRequired, message.TopicName)
+	}
+	msg, err := r.buildMessage(message)
+	if err != nil {
+		return nil, err
+	}
+	msg.WithShardingKey(key)
+	err = r.conn.Start()
+	if err != nil {
+		logger.Error(fmt.Sprintf("RocketMQ生产者Start错误:%s\n", err.Error()))
+		return nil, err
+	}
+	result, err := r.conn.SendSync(ctx, msg)
+	if err != nil {
+		return nil, err
+	}
+	logger.Debug(fmt.Sprintf("RocketMQ顺序消息【%s】key:%s 发送到队列:%s", message.TopicName, key, result.MessageQueue.String()))
+	return result, nil
+}
+
+// Publish 将同一条消息并发发送到多个主题，返回每个主题的发送结果(顺序与topics一致)。
+// requireAll为true时任一主题失败即返回ErrPublishIncomplete，否则只有全部失败才返回错误。
+// 已经发送成功的主题不会回滚
+func (r *producerClient) Publish(ctx context.Context, message *model.TopicMessage, topics []string, requireAll bool) ([]model.PublishResult, error) {
+	if len(topics) == 0 {
+		return nil, errors.New("RocketMQ扇出发送的主题列表为空")
+	}
+	msgs := make([]*primitive.Message, len(topics))
+	for i, topicName := range topics {
+		m := *message
+		m.TopicName = topicName
+		msg, err := r.buildMessage(&m)
+		if err != nil {
+			return nil, err
+		}
+		msgs[i] = msg
+	}
+	err := r.conn.Start()
+	if err != nil {
+		logger.Error(fmt.Sprintf("RocketMQ生产者Start错误:%s\n", err.Error()))
+		return nil, err
+	}
+	results := make([]model.PublishResult, len(topics))
+	var wg sync.WaitGroup
+	for i := range msgs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i].TopicName = topics[i]
+			results[i].Result, results[i].Err = r.conn.SendSync(ctx, msgs[i])
+		}(i)
+	}
+	wg.Wait()
+	var errs []error
+	for _, v := range results {
+		if v.Err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", v.TopicName, v.Err))
+		}
+	}
+	if len(errs) > 0 && (requireAll || len(errs) == len(results)) {
+		return results, fmt.Errorf("%w: %w", ErrPublishIncomplete, errors.Join(errs...))
+	}
+	return results, nil
+}
+
+// PublishRoute 按配置中的扇出路由发送
+func (r *producerClient) PublishRoute(ctx context.Context, route string, message *model.TopicMessage) ([]model.PublishResult, error) {
+	var pr model.PublishRoute
+	ok := false
+	if r.config != nil {
+		pr, ok = r.config.ProductConfig.Routes[route]
+	}
+	if !ok {
+		return nil, fmt.Errorf("RocketMQ扇出路由%s不存在", route)
+	}
+	return r.Publish(ctx, message, pr.Topics, pr.RequireAll)
+}
+
+// buildMessage 校验并将TopicMessage转换为primitive.Message
+func (r *producerClient) buildMessage(message *model.TopicMessage) (*primitive.Message, error) {
+	if message.ShardingKey == "" && r.isOrderedTopic(message.TopicName) {
+		return nil, fmt.Errorf("%w: %s", ErrShardingKeyRequired, message.TopicName)
+	}
+	if err := r.schemas.Validate(message.TopicName, message.Tags, []byte(message.Msg)); err != nil {
+		return nil, err
+	}
 	msg := &primitive.Message{
 		Topic: message.TopicName,
 		Body:  []byte(message.Msg),
@@ -201,6 +407,55 @@ func (r *producerClient) SendOne(message *model.TopicMessage) error {
 	if message.ShardingKey != "" {
 		msg.WithShardingKey(message.ShardingKey)
 	}
-	err = r.conn.SendOneWay(context.Background(), msg)
-	return err
+	for k, v := range message.Properties {
+		msg.WithProperty(k, v)
+	}
+	if message.DelayTimeLevel > 0 {
+		msg.WithDelayTimeLevel(message.DelayTimeLevel)
+	}
+	if r.shouldEncrypt(message.TopicName) {
+		if err := encryption.Encrypt(r.keys, msg); err != nil {
+			return nil, err
+		}
+	}
+	if r.signKeys != nil {
+		// 签名放在最后，覆盖加密后的消息体和属性
+		var props []string
+		if r.config != nil {
+			props = r.config.Signing.Properties
+		}
+		if err := signing.Sign(r.signKeys, msg, props); err != nil {
+			return nil, err
+		}
+	}
+	return msg, nil
+}
+
+// shouldEncrypt 是否需要加密该主题的消息
+func (r *producerClient) shouldEncrypt(topicName string) bool {
+	if r.keys == nil {
+		return false
+	}
+	if r.config == nil || len(r.config.Encryption.Topics) == 0 {
+		return true
+	}
+	for _, v := range r.config.Encryption.Topics {
+		if v == topicName {
+			return true
+		}
+	}
+	return false
+}
+
+// isOrderedTopic 是否为配置中声明的顺序主题
+func (r *producerClient) isOrderedTopic(topicName string) bool {
+	if r.config == nil {
+		return false
+	}
+	for _, v := range r.config.ProductConfig.OrderedTopics {
+		if v == topicName {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,100 @@
+package producer
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+	"github.com/ketianlin/krocketmq/encryption"
+	"github.com/ketianlin/krocketmq/model"
+	"github.com/ketianlin/krocketmq/schema"
+	"github.com/ketianlin/krocketmq/signing"
+)
+
+func newTestConfig() *model.Config {
+	return &model.Config{
+		NameServers:   []string{"127.0.0.1:9876"},
+		ProductConfig: model.ProductConfig{Group: "testProductGroup", LogLevel: "fatal"},
+	}
+}
+
+// initTestClient 用conf初始化r，测试结束时关闭
+func initTestClient(t *testing.T, r *producerClient, conf *model.Config) {
+	t.Helper()
+	r.InitConfig(conf, func(err error) {
+		t.Fatal(err)
+	})
+	t.Cleanup(r.Close)
+}
+
+func TestReinitResetsSignKeys(t *testing.T) {
+	t.Setenv("KRT_SIGN_KEY_CURRENT", "S1")
+	t.Setenv("KRT_SIGN_KEY_S1", base64.StdEncoding.EncodeToString(bytes.Repeat([]byte("s"), 32)))
+	conf := newTestConfig()
+	conf.Signing = model.SigningConfig{Enable: true, KeyEnvPrefix: "KRT_SIGN_KEY_"}
+	r := &producerClient{}
+	initTestClient(t, r, conf)
+	msg, err := r.buildMessage(&model.TopicMessage{TopicName: "T", Msg: "{}"})
+	if err != nil || msg.GetProperty(signing.PropertyKeyID) != "S1" || msg.GetProperty(signing.PropertySignature) == "" {
+		t.Fatalf("开启签名时消息应当签名, 实际: %v %v", msg, err)
+	}
+	r.Close()
+	initTestClient(t, r, newTestConfig())
+	msg, err = r.buildMessage(&model.TopicMessage{TopicName: "T", Msg: "{}"})
+	if err != nil || msg.GetProperty(signing.PropertySignature) != "" {
+		t.Fatalf("重新初始化后不应保留上一次配置的签名密钥, 实际: %v %v", msg, err)
+	}
+}
+
+func TestReinitResetsEncryptionKeys(t *testing.T) {
+	keys := map[string][]byte{"K1": bytes.Repeat([]byte{1}, 32), "K2": bytes.Repeat([]byte{2}, 32)}
+	for id, key := range keys {
+		t.Setenv("KRT_KEY_"+id, base64.StdEncoding.EncodeToString(key))
+	}
+	t.Setenv("KRT_KEY_CURRENT", "K2")
+	conf := newTestConfig()
+	conf.Encryption = model.EncryptionConfig{Enable: true, KeyEnvPrefix: "KRT_KEY_"}
+	r := &producerClient{}
+	initTestClient(t, r, conf)
+	msg, err := r.buildMessage(&model.TopicMessage{TopicName: "T", Msg: "secret"})
+	if err != nil || msg.GetProperty(encryption.PropertyKeyID) != "K2" {
+		t.Fatalf("应当使用轮换后的当前密钥加密, 实际: %v %v", msg, err)
+	}
+	provider, _ := encryption.NewStaticKeyProvider("K2", keys)
+	ext := &primitive.MessageExt{Message: primitive.Message{Topic: msg.Topic, Body: msg.Body}}
+	ext.WithProperties(msg.GetProperties())
+	if err = encryption.Decrypt(provider, ext); err != nil || string(ext.Body) != "secret" {
+		t.Fatalf("解密失败: %s %v", ext.Body, err)
+	}
+	r.Close()
+	initTestClient(t, r, newTestConfig())
+	msg, err = r.buildMessage(&model.TopicMessage{TopicName: "T", Msg: "secret"})
+	if err != nil || encryption.IsEncrypted(msg) || string(msg.Body) != "secret" {
+		t.Fatalf("重新初始化后不应保留上一次配置的密钥, 实际: %v %v", msg, err)
+	}
+}
+
+func TestReinitResetsSchemas(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "order.json")
+	if err := os.WriteFile(file, []byte(`{"type":"object","required":["orderId"]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	conf := newTestConfig()
+	conf.Schemas = []model.SchemaConfig{{Topic: "T", File: file}}
+	r := &producerClient{}
+	initTestClient(t, r, conf)
+	_, err := r.buildMessage(&model.TopicMessage{TopicName: "T", Msg: "{}"})
+	var ve *schema.ValidationError
+	if !errors.As(err, &ve) {
+		t.Fatalf("期望ValidationError, 实际: %v", err)
+	}
+	r.Close()
+	initTestClient(t, r, newTestConfig())
+	if _, err = r.buildMessage(&model.TopicMessage{TopicName: "T", Msg: "{}"}); err != nil {
+		t.Fatalf("重新初始化后不应保留上一次配置的schema: %v", err)
+	}
+}
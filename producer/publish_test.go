@@ -0,0 +1,95 @@
+package producer
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/apache/rocketmq-client-go/v2"
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+	"github.com/ketianlin/krocketmq/model"
+)
+
+// fakeProducer 发送到failTopics中的主题时返回错误，其余主题发送成功
+type fakeProducer struct {
+	rocketmq.Producer
+	failTopics map[string]bool
+	mu         sync.Mutex
+	sent       []string
+}
+
+func (p *fakeProducer) Start() error { return nil }
+
+func (p *fakeProducer) SendSync(ctx context.Context, msgs ...*primitive.Message) (*primitive.SendResult, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	topic := msgs[0].Topic
+	p.sent = append(p.sent, topic)
+	if p.failTopics[topic] {
+		return nil, errors.New("broker busy")
+	}
+	return &primitive.SendResult{Status: primitive.SendOK, MsgID: "id-" + topic}, nil
+}
+
+func newFakePublisher(failTopics ...string) (*producerClient, *fakeProducer) {
+	fp := &fakeProducer{failTopics: make(map[string]bool)}
+	for _, v := range failTopics {
+		fp.failTopics[v] = true
+	}
+	r := &producerClient{conn: fp, config: &model.Config{ProductConfig: model.ProductConfig{
+		Routes: map[string]model.PublishRoute{
+			"all":  {Topics: []string{"A", "B", "C"}, RequireAll: true},
+			"some": {Topics: []string{"A", "B", "C"}},
+		},
+	}}}
+	return r, fp
+}
+
+func TestPublishPartialFailure(t *testing.T) {
+	r, fp := newFakePublisher("B")
+	ctx := context.Background()
+	results, err := r.PublishRoute(ctx, "some", &model.TopicMessage{Msg: "hello"})
+	if err != nil {
+		t.Fatalf("非requireAll时部分失败不应返回错误: %v", err)
+	}
+	if len(results) != 3 || len(fp.sent) != 3 {
+		t.Fatalf("应发送到全部3个主题, 结果%d, 实际发送%v", len(results), fp.sent)
+	}
+	for i, topic := range []string{"A", "B", "C"} {
+		v := results[i]
+		if v.TopicName != topic {
+			t.Fatalf("结果顺序应与主题一致, 第%d个为%s", i, v.TopicName)
+		}
+		if topic == "B" {
+			if v.Err == nil || v.Result != nil {
+				t.Fatalf("B应当失败: %+v", v)
+			}
+		} else if v.Err != nil || v.Result.MsgID != "id-"+topic {
+			t.Fatalf("%s应当成功: %+v", topic, v)
+		}
+	}
+
+	results, err = r.PublishRoute(ctx, "all", &model.TopicMessage{Msg: "hello"})
+	if !errors.Is(err, ErrPublishIncomplete) {
+		t.Fatalf("requireAll时期望ErrPublishIncomplete, 实际%v", err)
+	}
+	if !strings.Contains(err.Error(), "B: broker busy") || strings.Contains(err.Error(), "A:") {
+		t.Fatalf("错误中应只包含失败的主题: %v", err)
+	}
+	if results[0].Err != nil || results[2].Err != nil || results[1].Err == nil {
+		t.Fatalf("requireAll失败时仍应返回每个主题的结果: %+v", results)
+	}
+}
+
+func TestPublishAllFailed(t *testing.T) {
+	r, _ := newFakePublisher("A", "B")
+	_, err := r.Publish(context.Background(), &model.TopicMessage{Msg: "hello"}, []string{"A", "B"}, false)
+	if !errors.Is(err, ErrPublishIncomplete) {
+		t.Fatalf("全部失败时期望ErrPublishIncomplete, 实际%v", err)
+	}
+	if !strings.Contains(err.Error(), "A: broker busy") || !strings.Contains(err.Error(), "B: broker busy") {
+		t.Fatalf("错误中应包含全部失败的主题: %v", err)
+	}
+}
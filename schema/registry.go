@@ -0,0 +1,101 @@
+package schema
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/ketianlin/krocketmq/model"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+type key struct {
+	topic string
+	tag   string
+}
+
+// Registry 主题(可选tag)到JSON Schema的映射
+type Registry struct {
+	mu      sync.RWMutex
+	schemas map[key]*gojsonschema.Schema
+}
+
+// ValidationError 消息体不符合JSON Schema
+type ValidationError struct {
+	Topic  string
+	Tag    string
+	Errors []string // 每一项为 字段: 错误描述
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("RocketMQ消息【%s:%s】未通过JSON Schema校验: %s", e.Topic, e.Tag, strings.Join(e.Errors, "; "))
+}
+
+func NewRegistry() *Registry {
+	return &Registry{schemas: make(map[key]*gojsonschema.Schema)}
+}
+
+// Load 根据配置加载所有schema文件，配置为空时返回nil
+func Load(conf []model.SchemaConfig) (*Registry, error) {
+	if len(conf) == 0 {
+		return nil, nil
+	}
+	r := NewRegistry()
+	for _, v := range conf {
+		if err := r.RegisterFile(v.Topic, v.Tag, v.File); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Register 注册schema，tag为空表示该主题下所有tag共用
+func (r *Registry) Register(topic, tag string, s *gojsonschema.Schema) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.schemas[key{topic, tag}] = s
+}
+
+// RegisterFile 从文件加载并注册schema
+func (r *Registry) RegisterFile(topic, tag, file string) error {
+	path, err := filepath.Abs(file)
+	if err != nil {
+		return err
+	}
+	s, err := gojsonschema.NewSchema(gojsonschema.NewReferenceLoader("file://" + filepath.ToSlash(path)))
+	if err != nil {
+		return fmt.Errorf("RocketMQ主题%s的JSON Schema文件%s加载失败:%w", topic, file, err)
+	}
+	r.Register(topic, tag, s)
+	return nil
+}
+
+// Validate 校验消息体，优先匹配topic+tag，其次匹配topic。没有对应schema时直接通过
+func (r *Registry) Validate(topic, tag string, body []byte) error {
+	if r == nil {
+		return nil
+	}
+	r.mu.RLock()
+	s, ok := r.schemas[key{topic, tag}]
+	if !ok {
+		s, ok = r.schemas[key{topic, ""}]
+	}
+	r.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+	result, err := s.Validate(gojsonschema.NewBytesLoader(body))
+	if err != nil {
+		// 消息体不是合法的JSON
+		return &ValidationError{Topic: topic, Tag: tag, Errors: []string{err.Error()}}
+	}
+	if result.Valid() {
+		return nil
+	}
+	ve := &ValidationError{Topic: topic, Tag: tag}
+	for _, e := range result.Errors() {
+		ve.Errors = append(ve.Errors, fmt.Sprintf("%s: %s", e.Field(), e.Description()))
+	}
+	return ve
+}
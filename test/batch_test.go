@@ -0,0 +1,47 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+	"github.com/ketianlin/krocketmq/consumer"
+	"github.com/ketianlin/krocketmq/model"
+)
+
+func TestSubscribeBatch(t *testing.T) {
+	initTestConsumer(t, &model.Config{ConsumerConfig: model.ConsumerConfig{ConsumeBatchMaxSize: 32}})
+	handler := func(ctx context.Context, msgs []*primitive.MessageExt) error { return nil }
+	sub, err := consumer.ConsumerClient.SubscribeBatch("TopicAnalytics", handler, consumer.WithBatchSize(16), consumer.WithTag("click"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sub.Topic() != "TopicAnalytics" || sub.Selector().Expression != "click" {
+		t.Fatalf("订阅句柄错误: %s %+v", sub.Topic(), sub.Selector())
+	}
+	if _, err = consumer.ConsumerClient.SubscribeBatch("TopicAnalytics", handler); err == nil {
+		t.Fatal("重复订阅应当报错")
+	}
+}
+
+func TestConsumeBatchMaxSizeConfig(t *testing.T) {
+	conf := &model.Config{NameServers: []string{"127.0.0.1:9876"}}
+	conf.ConsumerConfig = model.ConsumerConfig{Group: "testConsumerGroup", MonitoringTime: 3600, LogLevel: "fatal", ConsumeBatchMaxSize: 2048}
+	var initErr error
+	consumer.ConsumerClient.InitConfig(conf, func(im *model.InitCallbackMessage) {
+		initErr = im.InitError
+	})
+	defer consumer.ConsumerClient.Close()
+	if initErr == nil {
+		t.Fatal("consume_batch_max_size超过1024应当报错")
+	}
+}
+
+func TestBatchError(t *testing.T) {
+	cause := errors.New("insert failed")
+	var err error = &consumer.BatchError{Failed: []int{1, 3}, Err: cause}
+	if !errors.Is(err, cause) {
+		t.Fatal("BatchError应当可以Unwrap")
+	}
+}
@@ -0,0 +1,60 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ketianlin/krocketmq/consumer"
+	"github.com/ketianlin/krocketmq/model"
+)
+
+func TestParseConsumeTimestamp(t *testing.T) {
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	cases := []struct {
+		value string
+		want  time.Time
+	}{
+		{"2024-01-02T08:00:00+08:00", time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{"-2h", now.Add(-2 * time.Hour)},
+		{" -30m ", now.Add(-30 * time.Minute)},
+	}
+	for _, c := range cases {
+		got, err := consumer.ParseConsumeTimestamp(c.value, now)
+		if err != nil {
+			t.Fatalf("%q: %v", c.value, err)
+		}
+		if !got.Equal(c.want) {
+			t.Fatalf("%q: 期望%s, 实际%s", c.value, c.want, got)
+		}
+	}
+	for _, v := range []string{"", "yesterday", "20240102150405"} {
+		if _, err := consumer.ParseConsumeTimestamp(v, now); err == nil {
+			t.Fatalf("%q应当解析失败", v)
+		}
+	}
+}
+
+func TestConsumeFromConfig(t *testing.T) {
+	initTestConsumer(t, &model.Config{ConsumerConfig: model.ConsumerConfig{
+		ConsumeFrom:      consumer.ConsumeFromTimestamp,
+		ConsumeTimestamp: "-2h",
+	}})
+	consumer.ConsumerClient.Close()
+
+	for _, c := range []model.ConsumerConfig{
+		{ConsumeFrom: "middle"},
+		{ConsumeFrom: consumer.ConsumeFromTimestamp},
+	} {
+		conf := &model.Config{NameServers: []string{"127.0.0.1:9876"}, ConsumerConfig: c}
+		conf.ConsumerConfig.Group = "testConsumerGroup"
+		conf.ConsumerConfig.MonitoringTime = 3600
+		var initErr error
+		consumer.ConsumerClient.InitConfig(conf, func(im *model.InitCallbackMessage) {
+			initErr = im.InitError
+		})
+		consumer.ConsumerClient.Close()
+		if initErr == nil {
+			t.Fatalf("%+v应当报错", c)
+		}
+	}
+}
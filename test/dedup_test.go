@@ -0,0 +1,213 @@
+package test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+	"github.com/ketianlin/krocketmq/consumer"
+	"github.com/ketianlin/krocketmq/dedup"
+)
+
+func testDedupStore(t *testing.T, store consumer.DedupStore) {
+	ctx := context.Background()
+	calls := 0
+	failed := errors.New("failed")
+	fail := true
+	handler := consumer.Dedup(store)(func(ctx context.Context, msg *primitive.MessageExt) error {
+		calls++
+		if fail {
+			return failed
+		}
+		return nil
+	})
+	msg := newTestMessageExt("{}")
+	if err := handler(ctx, msg); !errors.Is(err, failed) {
+		t.Fatalf("期望handler的错误, 实际: %v", err)
+	}
+	fail = false
+	if err := handler(ctx, msg); err != nil {
+		t.Fatal(err)
+	}
+	if err := handler(ctx, msg); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Fatalf("处理成功后的重复消息不应再调用handler, 调用次数: %d", calls)
+	}
+
+	// handler panic时同样删除处理中标记，重新投递后可以再次处理
+	panicking := newTestMessageExt("{}")
+	panicking.MsgId = "panicking"
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("panic应当继续向外抛出")
+			}
+		}()
+		_ = consumer.Dedup(store)(func(ctx context.Context, msg *primitive.MessageExt) error {
+			panic("boom")
+		})(ctx, panicking)
+	}()
+	state, err := store.Acquire(ctx, "TopicOrder:panicking", time.Minute)
+	if err != nil || state != consumer.DedupAcquired {
+		t.Fatalf("panic后处理中标记应当已删除, 实际: %v %v", state, err)
+	}
+
+	state, err = store.Acquire(ctx, "TopicOrder:running", time.Minute)
+	if err != nil || state != consumer.DedupAcquired {
+		t.Fatalf("首次Acquire期望DedupAcquired, 实际: %v %v", state, err)
+	}
+	running := newTestMessageExt("{}")
+	running.MsgId = "running"
+	if err = handler(ctx, running); !errors.Is(err, consumer.ErrDedupInProgress) {
+		t.Fatalf("处理中的消息期望ErrDedupInProgress, 实际: %v", err)
+	}
+
+	state, err = store.Acquire(ctx, "TopicOrder:expired", time.Millisecond)
+	if err != nil || state != consumer.DedupAcquired {
+		t.Fatalf("首次Acquire期望DedupAcquired, 实际: %v %v", state, err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if state, err = store.Acquire(ctx, "TopicOrder:expired", time.Minute); err != nil || state != consumer.DedupAcquired {
+		t.Fatalf("过期的处理中标记应当可以重新获取, 实际: %v %v", state, err)
+	}
+}
+
+func TestDedupMemoryStore(t *testing.T) {
+	testDedupStore(t, dedup.NewMemoryStore())
+}
+
+func TestDedupFileStore(t *testing.T) {
+	store, err := dedup.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	testDedupStore(t, store)
+	if err = store.Sweep(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// fakeSQL 按SQLStore生成的语句在内存中模拟去重表的database/sql驱动，避免测试依赖cgo的数据库驱动
+type fakeSQL struct {
+	mu      sync.Mutex
+	rows    map[string][2]int64 // dedup_key -> state, expire_at
+	queries []string
+}
+
+type fakeSQLConn struct{ db *fakeSQL }
+
+type fakeSQLRows struct{ states []int64 }
+
+func (f *fakeSQL) Connect(context.Context) (driver.Conn, error) { return fakeSQLConn{f}, nil }
+func (f *fakeSQL) Driver() driver.Driver                        { return nil }
+
+func (c fakeSQLConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("不支持Prepare") }
+func (c fakeSQLConn) Close() error                        { return nil }
+func (c fakeSQLConn) Begin() (driver.Tx, error)           { return nil, errors.New("不支持事务") }
+
+func (c fakeSQLConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	f := c.db
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.queries = append(f.queries, query)
+	arg := func(i int) int64 { return args[i].Value.(int64) }
+	switch {
+	case strings.HasPrefix(query, "CREATE TABLE"):
+	case strings.HasPrefix(query, "INSERT"):
+		key := args[0].Value.(string)
+		if _, ok := f.rows[key]; ok {
+			return nil, errors.New("UNIQUE constraint failed")
+		}
+		f.rows[key] = [2]int64{arg(1), arg(2)}
+	case strings.HasPrefix(query, "UPDATE"):
+		key := args[2].Value.(string)
+		if _, ok := f.rows[key]; ok {
+			f.rows[key] = [2]int64{arg(0), arg(1)}
+		}
+	case strings.Contains(query, "dedup_key = ") && strings.Contains(query, "expire_at <= "):
+		if row, ok := f.rows[args[0].Value.(string)]; ok && row[1] <= arg(1) {
+			delete(f.rows, args[0].Value.(string))
+		}
+	case strings.Contains(query, "state = "):
+		if row, ok := f.rows[args[0].Value.(string)]; ok && row[0] == arg(1) {
+			delete(f.rows, args[0].Value.(string))
+		}
+	case strings.Contains(query, "expire_at <= "):
+		for key, row := range f.rows {
+			if row[1] <= arg(0) {
+				delete(f.rows, key)
+			}
+		}
+	default:
+		return nil, errors.New("未知语句:" + query)
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (c fakeSQLConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	f := c.db
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.queries = append(f.queries, query)
+	rows := &fakeSQLRows{}
+	if row, ok := f.rows[args[0].Value.(string)]; ok {
+		rows.states = append(rows.states, row[0])
+	}
+	return rows, nil
+}
+
+func (r *fakeSQLRows) Columns() []string { return []string{"state"} }
+func (r *fakeSQLRows) Close() error      { return nil }
+func (r *fakeSQLRows) Next(dest []driver.Value) error {
+	if len(r.states) == 0 {
+		return io.EOF
+	}
+	dest[0], r.states = r.states[0], r.states[1:]
+	return nil
+}
+
+func TestDedupSQLStore(t *testing.T) {
+	for _, dollar := range []bool{false, true} {
+		fake := &fakeSQL{rows: make(map[string][2]int64)}
+		db := sql.OpenDB(fake)
+		var opts []dedup.SQLOption
+		if dollar {
+			opts = append(opts, dedup.WithDollarPlaceholder())
+		}
+		store := dedup.NewSQLStore(db, "", opts...)
+		if err := store.CreateTable(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		testDedupStore(t, store)
+		if err := store.Sweep(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		for _, q := range fake.queries[1:] {
+			if !strings.Contains(q, "krocketmq_dedup") || strings.Contains(q, "$1") != dollar {
+				t.Fatalf("语句错误: %s", q)
+			}
+		}
+		db.Close()
+	}
+}
+
+func TestDedupByKeys(t *testing.T) {
+	msg := newTestMessageExt("{}")
+	if key := consumer.DedupByKeys(msg); key != "TopicOrder:order-1" {
+		t.Fatalf("key错误: %s", key)
+	}
+	msg.WithProperty(primitive.PropertyUniqueClientMessageIdKeyIndex, "uniq-1")
+	if key := consumer.DedupByMsgId(msg); key != "TopicOrder:uniq-1" {
+		t.Fatalf("key错误: %s", key)
+	}
+}
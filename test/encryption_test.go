@@ -0,0 +1,102 @@
+package test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+	"github.com/ketianlin/krocketmq/encryption"
+)
+
+func encryptedMessage(t *testing.T, p encryption.KeyProvider, body string) *primitive.MessageExt {
+	msg := primitive.NewMessage("UserTopic", []byte(body))
+	if err := encryption.Encrypt(p, msg); err != nil {
+		t.Fatal(err)
+	}
+	ext := &primitive.MessageExt{MsgId: "test"}
+	ext.Topic = msg.Topic
+	ext.Body = msg.Body
+	ext.WithProperties(msg.GetProperties())
+	return ext
+}
+
+func TestEncryptionRoundTripWithRotation(t *testing.T) {
+	k1, k2 := bytes.Repeat([]byte{1}, 32), bytes.Repeat([]byte{2}, 16)
+	p, err := encryption.NewStaticKeyProvider("k1", map[string][]byte{"k1": k1, "k2": k2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := encryptedMessage(t, p, `{"phone":"13800000000"}`)
+	if bytes.Contains(old.Body, []byte("13800000000")) {
+		t.Fatal("消息体应当已加密")
+	}
+	if old.GetProperty(encryption.PropertyKeyID) != "k1" {
+		t.Fatal("应当记录加密使用的keyID")
+	}
+
+	// 轮换后旧消息仍可解密
+	if err = p.SetCurrent("k2"); err != nil {
+		t.Fatal(err)
+	}
+	cur := encryptedMessage(t, p, "new")
+	for body, msg := range map[string]*primitive.MessageExt{`{"phone":"13800000000"}`: old, "new": cur} {
+		if err = encryption.Decrypt(p, msg); err != nil {
+			t.Fatal(err)
+		}
+		if string(msg.Body) != body || msg.GetProperty(encryption.PropertyKeyID) != "" {
+			t.Fatalf("解密结果错误: %s", msg.Body)
+		}
+	}
+}
+
+func TestEncryptionDecryptFailures(t *testing.T) {
+	p, _ := encryption.NewStaticKeyProvider("k1", map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)})
+	other, _ := encryption.NewStaticKeyProvider("k9", map[string][]byte{"k9": bytes.Repeat([]byte{9}, 32)})
+	msg := encryptedMessage(t, p, "secret")
+	if err := encryption.Decrypt(other, msg); !errors.Is(err, encryption.ErrKeyNotFound) {
+		t.Fatalf("期望ErrKeyNotFound, 实际: %v", err)
+	}
+	if err := encryption.Decrypt(nil, msg); err == nil {
+		t.Fatal("未配置KeyProvider时应当报错")
+	}
+	msg.Body[len(msg.Body)-1] ^= 0xff
+	if err := encryption.Decrypt(p, msg); err == nil {
+		t.Fatal("密文被篡改时应当报错")
+	}
+	plain := &primitive.MessageExt{}
+	plain.Topic, plain.Body = "UserTopic", []byte("plain")
+	if err := encryption.Decrypt(nil, plain); err != nil || string(plain.Body) != "plain" {
+		t.Fatalf("未加密消息应当原样返回: %v", err)
+	}
+}
+
+func TestEncryptionFileAndEnvProvider(t *testing.T) {
+	key := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, 32))
+	file := filepath.Join(t.TempDir(), "keys.json")
+	data := []byte(`{"current":"k1","keys":{"k1":"` + key + `"}}`)
+	if err := os.WriteFile(file, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	fp, err := encryption.NewFileKeyProvider(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TEST_MQ_KEY_k1", key)
+	t.Setenv("TEST_MQ_KEY_CURRENT", "k1")
+	ep, err := encryption.NewEnvKeyProvider("TEST_MQ_KEY_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := encryptedMessage(t, fp, "hello")
+	if err = encryption.Decrypt(ep, msg); err != nil || string(msg.Body) != "hello" {
+		t.Fatalf("文件与环境变量中的相同密钥应当可以互相解密: %v", err)
+	}
+	t.Setenv("TEST_MQ_KEY_bad", base64.StdEncoding.EncodeToString([]byte("short")))
+	if _, err = encryption.NewEnvKeyProvider("TEST_MQ_KEY_"); err == nil {
+		t.Fatal("密钥长度错误时应当报错")
+	}
+}
@@ -0,0 +1,57 @@
+package test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ketianlin/krocketmq"
+)
+
+func TestMessageBuilder(t *testing.T) {
+	msg, err := krocketmq.NewMessage("Order_Created-1").
+		Tag("paid").
+		Keys("order-1", "user-2").
+		ShardingKey("user-2").
+		Property("source", "app").
+		Delay(45 * time.Second).
+		JSON(map[string]int{"amount": 100}).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.TopicName != "Order_Created-1" || msg.Tags != "paid" || len(msg.Keys) != 2 || msg.ShardingKey != "user-2" {
+		t.Fatalf("消息字段错误: %+v", msg)
+	}
+	if msg.Properties["source"] != "app" || msg.Msg != `{"amount":100}` {
+		t.Fatalf("消息字段错误: %+v", msg)
+	}
+	// 45s向上取整到1m，即第5级
+	if msg.DelayTimeLevel != 5 {
+		t.Fatalf("期望延时级别5, 实际%d", msg.DelayTimeLevel)
+	}
+}
+
+func TestMessageBuilderValidation(t *testing.T) {
+	cases := map[string]*krocketmq.MessageBuilder{
+		"空主题":    krocketmq.NewMessage(""),
+		"主题非法字符": krocketmq.NewMessage("order.created"),
+		"主题过长":   krocketmq.NewMessage(strings.Repeat("a", krocketmq.MaxTopicLength+1)),
+		"tag非法":  krocketmq.NewMessage("Order").Tag("a||b"),
+		"key含空格": krocketmq.NewMessage("Order").Keys("a b"),
+		"保留属性":   krocketmq.NewMessage("Order").Property("KEYS", "x"),
+		"延时过长":   krocketmq.NewMessage("Order").Delay(3 * time.Hour),
+		"延时级别非法": krocketmq.NewMessage("Order").DelayLevel(19),
+		"JSON失败": krocketmq.NewMessage("Order").JSON(make(chan int)),
+	}
+	for name, b := range cases {
+		if _, err := b.Build(); err == nil {
+			t.Errorf("%s: 应当返回错误", name)
+		}
+	}
+	// 第一个错误会被保留
+	_, err := krocketmq.NewMessage("Order").Tag("a b").Keys("ok").Build()
+	if err == nil || !strings.Contains(err.Error(), "tag") {
+		t.Fatalf("应当返回第一个错误, 实际: %v", err)
+	}
+}
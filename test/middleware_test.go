@@ -0,0 +1,86 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+	"github.com/ketianlin/krocketmq/consumer"
+)
+
+func TestMiddlewareChain(t *testing.T) {
+	var calls []string
+	mw := func(name string) consumer.Middleware {
+		return func(next consumer.Handler) consumer.Handler {
+			return func(ctx context.Context, msg *primitive.MessageExt) error {
+				calls = append(calls, name+">")
+				err := next(ctx, msg)
+				calls = append(calls, "<"+name)
+				return err
+			}
+		}
+	}
+	handler := consumer.Chain(mw("a"), mw("b"))(func(ctx context.Context, msg *primitive.MessageExt) error {
+		calls = append(calls, "handler")
+		return nil
+	})
+	if err := handler(context.Background(), newTestMessageExt("{}")); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(calls, " "); got != "a> b> handler <b <a" {
+		t.Fatalf("执行顺序错误: %s", got)
+	}
+}
+
+// topicPanics expvar中记录的topic的panic次数
+func topicPanics(topic string) int64 {
+	if v, ok := expvar.Get("krocketmq_consumer_panics").(*expvar.Map).Get(topic).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
+
+func TestRecoveryMiddleware(t *testing.T) {
+	before := topicPanics("TopicOrder")
+	handler := consumer.Recovery()(func(ctx context.Context, msg *primitive.MessageExt) error {
+		panic("boom")
+	})
+	err := handler(context.Background(), newTestMessageExt("{}"))
+	var pe *consumer.PanicError
+	if !errors.As(err, &pe) || pe.Value != "boom" || len(pe.Stack) == 0 {
+		t.Fatalf("期望PanicError, 实际: %v", err)
+	}
+	// 消费者的PanicCount只统计经过该消费者处理的消息，单独调用时只记录到expvar
+	if topicPanics("TopicOrder") != before+1 {
+		t.Fatal("panic次数未记录")
+	}
+}
+
+func TestTimingAndTimeoutMiddleware(t *testing.T) {
+	failed := errors.New("failed")
+	var observed error
+	var deadline bool
+	handler := consumer.Chain(
+		consumer.Timing(func(msg *primitive.MessageExt, elapsed time.Duration, err error) {
+			observed = err
+		}),
+		consumer.Timeout(time.Second),
+		consumer.Logging(),
+	)(func(ctx context.Context, msg *primitive.MessageExt) error {
+		_, deadline = ctx.Deadline()
+		return failed
+	})
+	if err := handler(context.Background(), newTestMessageExt("{}")); !errors.Is(err, failed) {
+		t.Fatalf("错误应当原样返回, 实际: %v", err)
+	}
+	if !deadline {
+		t.Fatal("Timeout未设置ctx超时时间")
+	}
+	if !errors.Is(observed, failed) {
+		t.Fatalf("Timing未收到处理结果: %v", observed)
+	}
+}
@@ -0,0 +1,95 @@
+package test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ketianlin/krocketmq/internal/nsresolver"
+)
+
+func TestNsResolverParse(t *testing.T) {
+	cases := map[string][]string{
+		`["10.0.0.1:9876","10.0.0.2:9876"]`: {"10.0.0.1:9876", "10.0.0.2:9876"},
+		"10.0.0.1:9876;10.0.0.2:9876\n":     {"10.0.0.1:9876", "10.0.0.2:9876"},
+		"10.0.0.1:9876, 10.0.0.2:9876":      {"10.0.0.1:9876", "10.0.0.2:9876"},
+		"  ":                                {},
+	}
+	for body, want := range cases {
+		got, err := nsresolver.Parse([]byte(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("%q: 期望%v, 实际%v", body, want, got)
+		}
+	}
+	if _, err := nsresolver.Parse([]byte(`["a",`)); err == nil {
+		t.Fatal("非法JSON应当报错")
+	}
+}
+
+func TestNsResolverKeepLastKnownGood(t *testing.T) {
+	var down atomic.Bool
+	var body atomic.Value
+	body.Store("10.0.0.1:9876")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(body.Load().(string)))
+	}))
+	defer srv.Close()
+
+	res, err := nsresolver.New(srv.URL, 20*time.Millisecond, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Stop()
+	if got := res.Resolve(); !reflect.DeepEqual(got, []string{"10.0.0.1:9876"}) {
+		t.Fatalf("初始列表错误: %v", got)
+	}
+
+	body.Store("10.0.0.2:9876;10.0.0.3:9876")
+	waitFor(t, func() bool { return len(res.Resolve()) == 2 })
+
+	down.Store(true)
+	if err = res.Refresh(); err == nil {
+		t.Fatal("地址服务不可用时Refresh应当报错")
+	}
+	time.Sleep(60 * time.Millisecond)
+	if got := res.Resolve(); !reflect.DeepEqual(got, []string{"10.0.0.2:9876", "10.0.0.3:9876"}) {
+		t.Fatalf("应当保留最后一次成功的列表: %v", got)
+	}
+}
+
+func TestNsResolverFallback(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+	if _, err := nsresolver.New(srv.URL, time.Minute, nil); err == nil {
+		t.Fatal("没有兜底列表时应当报错")
+	}
+	res, err := nsresolver.New(srv.URL, time.Minute, []string{"127.0.0.1:9876"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Stop()
+	if got := res.Resolve(); !reflect.DeepEqual(got, []string{"127.0.0.1:9876"}) {
+		t.Fatalf("应当使用兜底列表: %v", got)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("等待超时")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
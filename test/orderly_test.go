@@ -0,0 +1,42 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ketianlin/krocketmq/model"
+	"github.com/ketianlin/krocketmq/producer"
+)
+
+func TestSendOrderlyRequiresKey(t *testing.T) {
+	mt := &model.TopicMessage{Msg: "hello", TopicName: "OrderTopic"}
+	_, err := producer.ProducerClient.SendOrderly(context.Background(), "", mt)
+	if !errors.Is(err, producer.ErrShardingKeyRequired) {
+		t.Fatalf("期望ErrShardingKeyRequired, 实际: %v", err)
+	}
+}
+
+func TestOrderedTopicRequiresShardingKey(t *testing.T) {
+	mc := model.Config{
+		NameServers: []string{"127.0.0.1:9876"},
+		ProductConfig: model.ProductConfig{
+			RetryCount:     2,
+			TopicQueueNums: 4,
+			Group:          "orderedProductGroup",
+			LogLevel:       "error",
+			OrderedTopics:  []string{"OrderTopic"},
+		},
+	}
+	producer.ProducerClient.InitConfig(&mc, func(err error) {
+		t.Fatal(err)
+	})
+	defer producer.ProducerClient.Close()
+	mt := &model.TopicMessage{Msg: "hello", TopicName: "OrderTopic"}
+	if err := producer.ProducerClient.SendSync(mt); !errors.Is(err, producer.ErrShardingKeyRequired) {
+		t.Fatalf("SendSync期望ErrShardingKeyRequired, 实际: %v", err)
+	}
+	if err := producer.ProducerClient.SendOne(mt); !errors.Is(err, producer.ErrShardingKeyRequired) {
+		t.Fatalf("SendOne期望ErrShardingKeyRequired, 实际: %v", err)
+	}
+}
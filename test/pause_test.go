@@ -0,0 +1,66 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ketianlin/krocketmq/consumer"
+)
+
+func TestPauseResume(t *testing.T) {
+	initTestConsumer(t, nil)
+	for _, topic := range []string{"TopicA", "TopicB"} {
+		if _, err := consumer.ConsumerClient.Subscribe(topic, noopListener); err != nil {
+			t.Fatal(err)
+		}
+	}
+	consumer.ConsumerClient.Pause("TopicA")
+	if !consumer.ConsumerClient.Paused("TopicA") || consumer.ConsumerClient.Paused("TopicB") {
+		t.Fatal("只应暂停TopicA")
+	}
+	consumer.ConsumerClient.Pause()
+	if got := consumer.ConsumerClient.PausedTopics(); !reflect.DeepEqual(got, []string{"TopicA", "TopicB"}) {
+		t.Fatalf("期望全部主题暂停, 实际%v", got)
+	}
+	// 未Start时不会调用PushConsumer.Suspend
+	if consumer.ConsumerClient.Suspended() {
+		t.Fatal("未启动的消费者不应停止拉取")
+	}
+	consumer.ConsumerClient.Resume("TopicB")
+	if got := consumer.ConsumerClient.PausedTopics(); !reflect.DeepEqual(got, []string{"TopicA"}) {
+		t.Fatalf("期望只有TopicA暂停, 实际%v", got)
+	}
+	consumer.ConsumerClient.Resume()
+	if got := consumer.ConsumerClient.PausedTopics(); len(got) != 0 {
+		t.Fatalf("期望全部恢复, 实际%v", got)
+	}
+}
+
+func TestPauseWhenUnhealthy(t *testing.T) {
+	initTestConsumer(t, nil)
+	for _, topic := range []string{"TopicA", "TopicB"} {
+		if _, err := consumer.ConsumerClient.Subscribe(topic, noopListener); err != nil {
+			t.Fatal(err)
+		}
+	}
+	consumer.ConsumerClient.Pause("TopicB")
+	var healthy atomic.Bool
+	stop := consumer.ConsumerClient.PauseWhenUnhealthy(10*time.Millisecond, func(ctx context.Context) error {
+		if healthy.Load() {
+			return nil
+		}
+		return errors.New("下游不可用")
+	})
+	defer stop()
+	waitFor(t, func() bool { return consumer.ConsumerClient.Paused("TopicA") })
+	healthy.Store(true)
+	waitFor(t, func() bool { return !consumer.ConsumerClient.Paused("TopicA") })
+	// 手动暂停的主题不会被健康检查恢复
+	if !consumer.ConsumerClient.Paused("TopicB") {
+		t.Fatal("TopicB应保持暂停")
+	}
+}
@@ -0,0 +1,44 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ketianlin/krocketmq/model"
+	"github.com/ketianlin/krocketmq/producer"
+)
+
+func TestPublishValidation(t *testing.T) {
+	mc := model.Config{
+		NameServers: []string{"127.0.0.1:9876"},
+		ProductConfig: model.ProductConfig{
+			Group:         "publishProductGroup",
+			LogLevel:      "error",
+			OrderedTopics: []string{"OrderTopic"},
+			Routes: map[string]model.PublishRoute{
+				"order": {Topics: []string{"OrderAudit", "OrderTopic"}, RequireAll: true},
+			},
+		},
+	}
+	producer.ProducerClient.InitConfig(&mc, func(err error) {
+		t.Fatal(err)
+	})
+	defer producer.ProducerClient.Close()
+	ctx := context.Background()
+	mt := &model.TopicMessage{Msg: "hello"}
+
+	if _, err := producer.ProducerClient.Publish(ctx, mt, nil, false); err == nil {
+		t.Fatal("主题列表为空应当报错")
+	}
+	if _, err := producer.ProducerClient.PublishRoute(ctx, "missing", mt); err == nil {
+		t.Fatal("路由不存在应当报错")
+	}
+	// 路由中包含顺序主题，缺少ShardingKey时整条消息都不发送
+	if _, err := producer.ProducerClient.PublishRoute(ctx, "order", mt); !errors.Is(err, producer.ErrShardingKeyRequired) {
+		t.Fatalf("期望ErrShardingKeyRequired, 实际: %v", err)
+	}
+	if mt.TopicName != "" {
+		t.Fatal("Publish不应修改调用方的消息")
+	}
+}
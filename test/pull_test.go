@@ -0,0 +1,50 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+	"github.com/ketianlin/krocketmq/consumer"
+	"github.com/ketianlin/krocketmq/model"
+)
+
+func TestPullConsumerNotInitialized(t *testing.T) {
+	if _, err := consumer.PullConsumerClient.Pull(context.Background(), 10); !errors.Is(err, consumer.ErrNotInitialized) {
+		t.Fatalf("未初始化时Pull应返回ErrNotInitialized, 实际%v", err)
+	}
+	if err := consumer.PullConsumerClient.Subscribe("testTopic"); !errors.Is(err, consumer.ErrNotInitialized) {
+		t.Fatalf("未初始化时Subscribe应返回ErrNotInitialized, 实际%v", err)
+	}
+}
+
+func TestPullConsumerSeek(t *testing.T) {
+	conf := &model.Config{NameServers: []string{"127.0.0.1:9876"}}
+	conf.ConsumerConfig.Group = "testPullConsumerGroup"
+	conf.ConsumerConfig.LogLevel = "fatal"
+	consumer.PullConsumerClient.InitConfig(conf, func(im *model.InitCallbackMessage) {
+		if im.InitError != nil {
+			t.Fatal(im.InitError)
+		}
+	})
+	t.Cleanup(consumer.PullConsumerClient.Close)
+	if err := consumer.PullConsumerClient.Start(); err == nil {
+		t.Fatal("未Subscribe时Start应当失败")
+	}
+	if err := consumer.PullConsumerClient.Subscribe("testTopic", consumer.WithTag("a||b")); err != nil {
+		t.Fatal(err)
+	}
+	mq := &primitive.MessageQueue{Topic: "testTopic", BrokerName: "broker-a", QueueId: 1}
+	consumer.PullConsumerClient.Seek(mq, 42)
+	offset, err := consumer.PullConsumerClient.Position(mq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offset != 42 {
+		t.Fatalf("期望位置42, 实际%d", offset)
+	}
+	if err = consumer.PullConsumerClient.Commit(context.Background()); !errors.Is(err, consumer.ErrNotInitialized) {
+		t.Fatalf("未Start时Commit应返回ErrNotInitialized, 实际%v", err)
+	}
+}
@@ -0,0 +1,93 @@
+package test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ketianlin/krocketmq/model"
+	"github.com/ketianlin/krocketmq/producer"
+	"github.com/ketianlin/krocketmq/schema"
+)
+
+const orderSchema = `{
+  "type": "object",
+  "required": ["orderId", "amount"],
+  "properties": {
+    "orderId": {"type": "string"},
+    "amount": {"type": "number", "minimum": 0}
+  }
+}`
+
+func writeSchema(t *testing.T) string {
+	file := filepath.Join(t.TempDir(), "order.json")
+	if err := os.WriteFile(file, []byte(orderSchema), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestSchemaRegistryValidate(t *testing.T) {
+	reg, err := schema.Load([]model.SchemaConfig{{Topic: "Order", File: writeSchema(t)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = reg.Validate("Order", "created", []byte(`{"orderId":"1","amount":10}`)); err != nil {
+		t.Fatalf("合法消息不应报错: %v", err)
+	}
+	if err = reg.Validate("Other", "", []byte(`not json`)); err != nil {
+		t.Fatalf("没有schema的主题不应校验: %v", err)
+	}
+	err = reg.Validate("Order", "created", []byte(`{"orderId":1,"amount":-1}`))
+	var ve *schema.ValidationError
+	if !errors.As(err, &ve) {
+		t.Fatalf("期望ValidationError, 实际: %v", err)
+	}
+	if len(ve.Errors) != 2 {
+		t.Fatalf("期望2个字段错误, 实际: %v", ve.Errors)
+	}
+	if err = reg.Validate("Order", "", []byte(`{`)); !errors.As(err, &ve) {
+		t.Fatalf("非法JSON期望ValidationError, 实际: %v", err)
+	}
+}
+
+func TestSchemaRegistryTagPriority(t *testing.T) {
+	reg := schema.NewRegistry()
+	if err := reg.RegisterFile("Order", "", writeSchema(t)); err != nil {
+		t.Fatal(err)
+	}
+	tagSchema := filepath.Join(t.TempDir(), "tag.json")
+	if err := os.WriteFile(tagSchema, []byte(`{"type":"array"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := reg.RegisterFile("Order", "batch", tagSchema); err != nil {
+		t.Fatal(err)
+	}
+	if err := reg.Validate("Order", "batch", []byte(`[1,2]`)); err != nil {
+		t.Fatalf("应当优先使用tag对应的schema: %v", err)
+	}
+	if err := reg.Validate("Order", "created", []byte(`[1,2]`)); err == nil {
+		t.Fatal("其它tag应当使用主题级schema")
+	}
+}
+
+func TestProducerRejectsInvalidPayload(t *testing.T) {
+	mc := model.Config{
+		NameServers: []string{"127.0.0.1:9876"},
+		Schemas:     []model.SchemaConfig{{Topic: "Order", File: writeSchema(t)}},
+		ProductConfig: model.ProductConfig{
+			Group:    "schemaProductGroup",
+			LogLevel: "error",
+		},
+	}
+	producer.ProducerClient.InitConfig(&mc, func(err error) {
+		t.Fatal(err)
+	})
+	defer producer.ProducerClient.Close()
+	err := producer.ProducerClient.SendSync(&model.TopicMessage{Msg: `{"orderId":"1"}`, TopicName: "Order"})
+	var ve *schema.ValidationError
+	if !errors.As(err, &ve) {
+		t.Fatalf("期望ValidationError, 实际: %v", err)
+	}
+}
@@ -0,0 +1,66 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+	"github.com/ketianlin/krocketmq/encryption"
+	"github.com/ketianlin/krocketmq/signing"
+)
+
+func signedMessage(t *testing.T, p signing.KeyProvider) *primitive.MessageExt {
+	msg := primitive.NewMessage("PayTopic", []byte(`{"amount":100}`))
+	msg.WithTag("paid")
+	msg.WithKeys([]string{"order-1"})
+	if err := signing.Sign(p, msg, []string{primitive.PropertyTags, primitive.PropertyKeys}); err != nil {
+		t.Fatal(err)
+	}
+	ext := &primitive.MessageExt{MsgId: "test"}
+	ext.Topic = msg.Topic
+	ext.Body = msg.Body
+	ext.WithProperties(msg.GetProperties())
+	return ext
+}
+
+func TestSigningVerify(t *testing.T) {
+	p, _ := encryption.NewStaticKeyProvider("s1", map[string][]byte{
+		"s1": bytes.Repeat([]byte{1}, 32),
+		"s2": bytes.Repeat([]byte{2}, 32),
+	})
+	msg := signedMessage(t, p)
+	if err := signing.Verify(p, msg); err != nil {
+		t.Fatalf("签名应当校验通过: %v", err)
+	}
+	// 轮换后旧签名仍可校验
+	_ = p.SetCurrent("s2")
+	if err := signing.Verify(p, msg); err != nil {
+		t.Fatalf("轮换后旧签名应当校验通过: %v", err)
+	}
+	if signedMessage(t, p).GetProperty(signing.PropertyKeyID) != "s2" {
+		t.Fatal("应当使用当前密钥签名")
+	}
+
+	tampered := signedMessage(t, p)
+	tampered.Body = []byte(`{"amount":1}`)
+	if err := signing.Verify(p, tampered); !errors.Is(err, signing.ErrInvalidSignature) {
+		t.Fatalf("篡改消息体期望ErrInvalidSignature, 实际: %v", err)
+	}
+	tampered = signedMessage(t, p)
+	tampered.WithTag("refund")
+	if err := signing.Verify(p, tampered); !errors.Is(err, signing.ErrInvalidSignature) {
+		t.Fatalf("篡改签名属性期望ErrInvalidSignature, 实际: %v", err)
+	}
+
+	untrusted, _ := encryption.NewStaticKeyProvider("x", map[string][]byte{"x": bytes.Repeat([]byte{3}, 32)})
+	if err := signing.Verify(untrusted, signedMessage(t, p)); !errors.Is(err, signing.ErrInvalidSignature) {
+		t.Fatalf("未知keyID期望ErrInvalidSignature, 实际: %v", err)
+	}
+
+	unsigned := &primitive.MessageExt{}
+	unsigned.Body = []byte("x")
+	if err := signing.Verify(p, unsigned); !errors.Is(err, signing.ErrUnsigned) {
+		t.Fatalf("未签名消息期望ErrUnsigned, 实际: %v", err)
+	}
+}
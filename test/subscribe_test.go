@@ -0,0 +1,222 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"testing"
+
+	rmqconsumer "github.com/apache/rocketmq-client-go/v2/consumer"
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+	"github.com/ketianlin/krocketmq/consumer"
+	"github.com/ketianlin/krocketmq/model"
+)
+
+func initTestConsumer(t *testing.T, conf *model.Config) {
+	if conf == nil {
+		conf = &model.Config{}
+	}
+	conf.NameServers = []string{"127.0.0.1:9876"}
+	if conf.ConsumerConfig.Group == "" {
+		conf.ConsumerConfig.Group = "testConsumerGroup"
+	}
+	conf.ConsumerConfig.MonitoringTime = 3600
+	conf.ConsumerConfig.LogLevel = "fatal"
+	consumer.ConsumerClient.InitConfig(conf, func(im *model.InitCallbackMessage) {
+		if im.InitError != nil {
+			t.Fatal(im.InitError)
+		}
+	})
+	t.Cleanup(consumer.ConsumerClient.Close)
+}
+
+func noopListener(msg *primitive.MessageExt) {}
+
+func TestSubscribeMultipleTopics(t *testing.T) {
+	if _, err := consumer.ConsumerClient.Subscribe("TopicA", noopListener); !errors.Is(err, consumer.ErrNotInitialized) {
+		t.Fatalf("未初始化时期望ErrNotInitialized, 实际: %v", err)
+	}
+	initTestConsumer(t, nil)
+	for _, topic := range []string{"TopicA", "TopicB"} {
+		if _, err := consumer.ConsumerClient.Subscribe(topic, noopListener); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := consumer.ConsumerClient.Subscribe("TopicA", noopListener); err == nil {
+		t.Fatal("重复订阅应当报错")
+	}
+	topics := consumer.ConsumerClient.Topics()
+	sort.Strings(topics)
+	if len(topics) != 2 || topics[0] != "TopicA" || topics[1] != "TopicB" {
+		t.Fatalf("订阅主题错误: %v", topics)
+	}
+}
+
+func TestSubscriptionHandle(t *testing.T) {
+	initTestConsumer(t, nil)
+	a, err := consumer.ConsumerClient.Subscribe("TopicA", noopListener)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := consumer.ConsumerClient.Subscribe("TopicB", noopListener)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = a.Unsubscribe(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-a.Done():
+	default:
+		t.Fatal("Unsubscribe后Done应当关闭")
+	}
+	if a.Err() != nil || b.Err() != nil {
+		t.Fatalf("主动取消订阅不应有错误: %v %v", a.Err(), b.Err())
+	}
+	if topics := consumer.ConsumerClient.Topics(); len(topics) != 1 || topics[0] != "TopicB" {
+		t.Fatalf("订阅主题错误: %v", topics)
+	}
+	// 取消后可以重新订阅
+	if _, err = consumer.ConsumerClient.Subscribe("TopicA", noopListener); err != nil {
+		t.Fatal(err)
+	}
+	consumer.ConsumerClient.Close()
+	<-b.Done()
+	if !errors.Is(b.Err(), consumer.ErrConsumerClosed) {
+		t.Fatalf("期望ErrConsumerClosed, 实际: %v", b.Err())
+	}
+}
+
+func TestRunStartFailureEndsSubscriptions(t *testing.T) {
+	initTestConsumer(t, nil)
+	sub, err := consumer.ConsumerClient.Subscribe("TopicNotExist", noopListener)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 没有可用的name server，启动失败时Run直接返回错误
+	if err = consumer.ConsumerClient.Run(context.Background()); err == nil {
+		t.Fatal("启动失败时Run应当返回错误")
+	}
+	<-sub.Done()
+	if sub.Err() == nil {
+		t.Fatal("启动失败时订阅应当带错误结束")
+	}
+}
+
+func TestSubscribeSelector(t *testing.T) {
+	initTestConsumer(t, &model.Config{ConsumerConfig: model.ConsumerConfig{
+		Subscriptions: map[string]model.SubscriptionConfig{
+			"TopicTag": {Tag: "TagA || TagB"},
+			"TopicSql": {Sql: "region = 'cn'"},
+			"TopicBad": {Tag: "TagA", Sql: "a > 1"},
+		},
+	}})
+	cases := []struct {
+		topic string
+		opts  []consumer.SubscribeOption
+		want  rmqconsumer.MessageSelector
+	}{
+		{"TopicTag", nil, rmqconsumer.MessageSelector{Type: rmqconsumer.TAG, Expression: "TagA || TagB"}},
+		{"TopicSql", nil, rmqconsumer.MessageSelector{Type: rmqconsumer.SQL92, Expression: "region = 'cn'"}},
+		{"TopicAll", nil, rmqconsumer.MessageSelector{}},
+		{"TopicBad", []consumer.SubscribeOption{consumer.WithSQL("amount > 100")}, rmqconsumer.MessageSelector{Type: rmqconsumer.SQL92, Expression: "amount > 100"}},
+	}
+	for _, c := range cases {
+		sub, err := consumer.ConsumerClient.Subscribe(c.topic, noopListener, c.opts...)
+		if err != nil {
+			t.Fatalf("%s: %v", c.topic, err)
+		}
+		if sub.Selector() != c.want {
+			t.Fatalf("%s: 过滤条件错误: %+v", c.topic, sub.Selector())
+		}
+	}
+	if _, err := consumer.ConsumerClient.Subscribe("TopicOther", noopListener, consumer.WithTag("A"), consumer.WithSQL("a > 1")); err == nil {
+		t.Fatal("同时指定tag和sql应当报错")
+	}
+}
+
+func TestSubscribeSelectorConfigConflict(t *testing.T) {
+	initTestConsumer(t, &model.Config{ConsumerConfig: model.ConsumerConfig{
+		Subscriptions: map[string]model.SubscriptionConfig{"TopicBad": {Tag: "TagA", Sql: "a > 1"}},
+	}})
+	if _, err := consumer.ConsumerClient.Subscribe("TopicBad", noopListener); err == nil {
+		t.Fatal("配置同时包含tag和sql应当报错")
+	}
+}
+
+func TestSubscribeHandler(t *testing.T) {
+	initTestConsumer(t, nil)
+	handler := func(ctx context.Context, msg *primitive.MessageExt) error { return nil }
+	sub, err := consumer.ConsumerClient.SubscribeHandler("TopicA", handler, consumer.WithTag("TagA"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sub.Topic() != "TopicA" || sub.Selector().Expression != "TagA" {
+		t.Fatalf("订阅句柄错误: %s %+v", sub.Topic(), sub.Selector())
+	}
+	if _, err = consumer.ConsumerClient.SubscribeHandler("TopicA", handler); err == nil {
+		t.Fatal("重复订阅应当报错")
+	}
+}
+
+func TestConsumeMode(t *testing.T) {
+	initTestConsumer(t, nil)
+	if !consumer.ConsumerClient.Orderly() {
+		t.Fatal("默认应当为顺序消费")
+	}
+	consumer.ConsumerClient.Close()
+	initTestConsumer(t, &model.Config{ConsumerConfig: model.ConsumerConfig{ConsumeMode: consumer.ConsumeModeConcurrently}})
+	if consumer.ConsumerClient.Orderly() {
+		t.Fatal("concurrently应当为并发消费")
+	}
+	consumer.ConsumerClient.Close()
+
+	conf := &model.Config{NameServers: []string{"127.0.0.1:9876"}}
+	conf.ConsumerConfig = model.ConsumerConfig{Group: "testConsumerGroup", MonitoringTime: 3600, LogLevel: "fatal", ConsumeMode: "fifo"}
+	var initErr error
+	consumer.ConsumerClient.InitConfig(conf, func(im *model.InitCallbackMessage) {
+		initErr = im.InitError
+	})
+	defer consumer.ConsumerClient.Close()
+	if initErr == nil {
+		t.Fatal("错误的消费模式应当报错")
+	}
+}
+
+func TestMessageModel(t *testing.T) {
+	initTestConsumer(t, &model.Config{ConsumerConfig: model.ConsumerConfig{
+		MessageModel:   consumer.MessageModelBroadcasting,
+		OffsetStoreDir: t.TempDir(),
+	}})
+	consumer.ConsumerClient.Close()
+
+	conf := &model.Config{NameServers: []string{"127.0.0.1:9876"}}
+	conf.ConsumerConfig = model.ConsumerConfig{Group: "testConsumerGroup", MonitoringTime: 3600, LogLevel: "fatal", MessageModel: "p2p"}
+	var initErr error
+	consumer.ConsumerClient.InitConfig(conf, func(im *model.InitCallbackMessage) {
+		initErr = im.InitError
+	})
+	defer consumer.ConsumerClient.Close()
+	if initErr == nil {
+		t.Fatal("错误的消息模式应当报错")
+	}
+}
+
+func TestPanicPolicyConfig(t *testing.T) {
+	initTestConsumer(t, &model.Config{ConsumerConfig: model.ConsumerConfig{PanicPolicy: consumer.PanicPolicyDeadLetter}})
+	if consumer.ConsumerClient.PanicCount() != 0 {
+		t.Fatal("未处理消息时panic次数应为0")
+	}
+	consumer.ConsumerClient.Close()
+
+	conf := &model.Config{NameServers: []string{"127.0.0.1:9876"}}
+	conf.ConsumerConfig = model.ConsumerConfig{Group: "testConsumerGroup", MonitoringTime: 3600, LogLevel: "fatal", PanicPolicy: "ignore"}
+	var initErr error
+	consumer.ConsumerClient.InitConfig(conf, func(im *model.InitCallbackMessage) {
+		initErr = im.InitError
+	})
+	defer consumer.ConsumerClient.Close()
+	if initErr == nil {
+		t.Fatal("错误的panic处理策略应当报错")
+	}
+}
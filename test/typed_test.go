@@ -0,0 +1,104 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+	"github.com/ketianlin/krocketmq/consumer"
+)
+
+type order struct {
+	Id     int    `json:"id"`
+	Status string `json:"status"`
+}
+
+func newTestMessageExt(body string) *primitive.MessageExt {
+	msg := &primitive.MessageExt{MsgId: "msg-1", ReconsumeTimes: 2}
+	msg.Topic = "TopicOrder"
+	msg.Body = []byte(body)
+	msg.WithTag("created")
+	msg.WithKeys([]string{"order-1"})
+	return msg
+}
+
+func TestTypedHandler(t *testing.T) {
+	var got order
+	var meta consumer.Meta
+	handler := consumer.Typed(func(ctx context.Context, v order, m consumer.Meta) error {
+		got, meta = v, m
+		return nil
+	})
+	if err := handler(context.Background(), newTestMessageExt(`{"id":1,"status":"paid"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if got.Id != 1 || got.Status != "paid" {
+		t.Fatalf("解码结果错误: %+v", got)
+	}
+	if meta.Topic != "TopicOrder" || meta.Tags != "created" || meta.Keys != "order-1" || meta.MsgId != "msg-1" || meta.ReconsumeTimes != 2 {
+		t.Fatalf("Meta错误: %+v", meta)
+	}
+
+	failed := errors.New("failed")
+	handler = consumer.Typed(func(ctx context.Context, v order, m consumer.Meta) error {
+		return failed
+	})
+	if err := handler(context.Background(), newTestMessageExt(`{"id":1}`)); !errors.Is(err, failed) {
+		t.Fatalf("handler的错误应当原样返回, 实际: %v", err)
+	}
+}
+
+func TestTypedDecodeError(t *testing.T) {
+	var decodeErr *consumer.DecodeError
+	called := false
+	handler := consumer.Typed(func(ctx context.Context, v order, m consumer.Meta) error {
+		called = true
+		return nil
+	}, consumer.WithDecodeErrorHandler(func(msg *primitive.MessageExt, err *consumer.DecodeError) {
+		decodeErr = err
+	}))
+	if err := handler(context.Background(), newTestMessageExt(`not json`)); err != nil {
+		t.Fatalf("解码失败的消息应当确认, 实际: %v", err)
+	}
+	if called {
+		t.Fatal("解码失败时不应调用handler")
+	}
+	if decodeErr == nil || decodeErr.Topic != "TopicOrder" || decodeErr.MsgId != "msg-1" {
+		t.Fatalf("解码错误处理函数未被调用: %v", decodeErr)
+	}
+}
+
+type suffixCodec struct{}
+
+func (suffixCodec) Unmarshal(data []byte, v interface{}) error {
+	*(v.(*string)) = string(data) + "!"
+	return nil
+}
+
+func TestTypedCodec(t *testing.T) {
+	var got string
+	handler := consumer.Typed(func(ctx context.Context, v string, m consumer.Meta) error {
+		got = v
+		return nil
+	}, consumer.WithCodec(suffixCodec{}))
+	if err := handler(context.Background(), newTestMessageExt("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if got != "hello!" {
+		t.Fatalf("自定义Codec未生效: %s", got)
+	}
+}
+
+func TestTypedSubscribe(t *testing.T) {
+	initTestConsumer(t, nil)
+	sub, err := consumer.Subscribe("TopicOrder", func(ctx context.Context, v order, m consumer.Meta) error {
+		return nil
+	}, consumer.WithTag("created"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sub.Selector().Expression != "created" {
+		t.Fatalf("过滤条件错误: %+v", sub.Selector())
+	}
+}